@@ -0,0 +1,128 @@
+//go:build mongo
+
+package ordered
+
+// BSON encoding of OrderedMap with the MongoDB Go driver, built only with the "mongo" build tag so the
+// package keeps no dependency otherwise: go build -tags mongo, with go.mongodb.org/mongo-driver/v2
+// available. The methods implement the bson.Marshaler and bson.Unmarshaler interfaces of the driver,
+// so it keeps the keys order when storing or loading an OrderedMap, also nested in a struct.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// this implements the bson.Marshaler interface of the MongoDB Go driver, the keys are written in order,
+// nested OrderedMap and []interface{} values included, a map[string]interface{} with its keys sorted;
+// any other value is encoded by the driver, such as a bson.ObjectID, a bson.DateTime or a time.Time
+func (om *OrderedMap) MarshalBSON() ([]byte, error) {
+	return bson.Marshal(toBSON(om))
+}
+
+// the value as a bson.D for an object and a bson.A for an array, which the driver writes in order
+func toBSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *OrderedMap:
+		if v == nil {
+			return nil
+		}
+		d := make(bson.D, 0, v.l.Len())
+		for e := v.l.Front(); e != nil; e = e.Next() {
+			key := e.Value.(string)
+			d = append(d, bson.E{Key: key, Value: toBSON(v.m[key])})
+		}
+		return d
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		d := make(bson.D, 0, len(keys))
+		for _, key := range keys {
+			d = append(d, bson.E{Key: key, Value: toBSON(v[key])})
+		}
+		return d
+	case []interface{}:
+		return toBSONArray(v)
+	case MultiValue:
+		return toBSONArray(v)
+	}
+	return v
+}
+
+func toBSONArray(arr []interface{}) bson.A {
+	a := make(bson.A, len(arr))
+	for i, elem := range arr {
+		a[i] = toBSON(elem)
+	}
+	return a
+}
+
+// this implements the bson.Unmarshaler interface of the MongoDB Go driver, the keys keep the order
+// of the document; any existing content of the map is reset first. The nested documents are decoded
+// as *OrderedMap and the arrays as []interface{}, any other value as the driver decodes it into an
+// interface{}, such as an int32, a bson.ObjectID, a bson.DateTime or a bson.Decimal128
+func (om *OrderedMap) UnmarshalBSON(data []byte) error {
+	om.reset()
+	raw := bson.Raw(data)
+	if err := raw.Validate(); err != nil {
+		return err
+	}
+	if size := int(binary.LittleEndian.Uint32(data)); size < len(data) {
+		return fmt.Errorf("expect end of BSON document but got %d more bytes", len(data)-size)
+	}
+	return om.parseBSONDocument(raw)
+}
+
+func (om *OrderedMap) parseBSONDocument(raw bson.Raw) error {
+	elems, err := raw.Elements()
+	if err != nil {
+		return err
+	}
+	for _, elem := range elems {
+		value, err := parseBSONValue(elem.Value())
+		if err != nil {
+			return fmt.Errorf("BSON key %q: %v", elem.Key(), err)
+		}
+		// written directly like parseobject, so it isn't recorded by History; a duplicate key
+		// keeps its first position, same as Set
+		key := elem.Key()
+		if _, ok := om.m[key]; !ok {
+			om.keys[key] = om.l.PushBack(key)
+		}
+		om.m[key] = value
+	}
+	return nil
+}
+
+func parseBSONValue(rv bson.RawValue) (interface{}, error) {
+	switch rv.Type {
+	case bson.TypeEmbeddedDocument:
+		om := NewOrderedMap()
+		if err := om.parseBSONDocument(rv.Document()); err != nil {
+			return nil, err
+		}
+		return om, nil
+	case bson.TypeArray:
+		values, err := rv.Array().Values()
+		if err != nil {
+			return nil, err
+		}
+		arr := make([]interface{}, len(values))
+		for i, elem := range values {
+			if arr[i], err = parseBSONValue(elem); err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	}
+	var v interface{}
+	if err := rv.Unmarshal(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -0,0 +1,154 @@
+//go:build mongo
+
+package ordered
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestMarshalBSONSpecExample(t *testing.T) {
+	// the example of http://bsonspec.org/faq.html
+	om := NewOrderedMapFromKVPairs([]*KVPair{{"BSON", []interface{}{"awesome", 5.05, 1986}}})
+	b, err := om.MarshalBSON()
+	if err != nil {
+		t.Fatalf("MarshalBSON: %v", err)
+	}
+	expected := "\x31\x00\x00\x00\x04BSON\x00\x26\x00\x00\x00\x020\x00\x08\x00\x00\x00awesome\x00" +
+		"\x011\x00\x33\x33\x33\x33\x33\x33\x14\x40\x102\x00\xc2\x07\x00\x00\x00\x00"
+	if string(b) != expected {
+		t.Fatalf("MarshalBSON: %q not equal to expected %q", b, expected)
+	}
+}
+
+func TestBSONRoundTrip(t *testing.T) {
+	id, _ := bson.ObjectIDFromHex("5cd0010203040506c7080910")
+	decimal, _ := bson.ParseDecimal128("1234.5678")
+	om := NewOrderedMapFromKVPairs([]*KVPair{
+		{"_id", id},
+		{"zeta", "last first"},
+		{"count", int64(1) << 40},
+		{"small", int32(-7)},
+		{"ratio", 0.25},
+		{"ok", true},
+		{"nothing", nil},
+		{"raw", bson.Binary{Data: []byte{0, 1, 2}}},
+		{"when", bson.NewDateTimeFromTime(time.Date(2019, 5, 6, 7, 8, 9, 123e6, time.UTC))},
+		{"price", decimal},
+		{"ts", bson.Timestamp{T: 1, I: 2}},
+		{"re", bson.Regex{Pattern: "^a", Options: "i"}},
+		{"nested", NewOrderedMapFromKVPairs([]*KVPair{
+			{"y", "1"},
+			{"x", []interface{}{"a", NewOrderedMapFromKVPairs([]*KVPair{{"c", false}, {"b", true}})}},
+		})},
+		{"alpha", []interface{}{}},
+	})
+
+	b, err := om.MarshalBSON()
+	if err != nil {
+		t.Fatalf("MarshalBSON: %v", err)
+	}
+	decoded := NewOrderedMap()
+	decoded.Set("stale", 1)
+	if err := decoded.UnmarshalBSON(b); err != nil {
+		t.Fatalf("UnmarshalBSON: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, om) {
+		t.Fatalf("BSON round trip: %#v not deeply equal to expected %#v", decoded, om)
+	}
+	if keys := decoded.Keys(); keys[0] != "_id" || keys[1] != "zeta" || keys[len(keys)-1] != "alpha" {
+		t.Fatalf("BSON round trip: keys order not kept %q", keys)
+	}
+}
+
+func TestBSONConversions(t *testing.T) {
+	om := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"i": 42, "f": 1.5, "m": [1]}`), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	om.Set("int", 3)
+	om.Set("std", map[string]interface{}{"b": 2, "a": 1})
+	om.Set("time", time.Unix(1, 0))
+	b, err := om.MarshalBSON()
+	if err != nil {
+		t.Fatalf("MarshalBSON: %v", err)
+	}
+	decoded := NewOrderedMap()
+	if err := decoded.UnmarshalBSON(b); err != nil {
+		t.Fatalf("UnmarshalBSON: %v", err)
+	}
+	expected := NewOrderedMapFromKVPairs([]*KVPair{
+		{"i", int64(42)},
+		{"f", 1.5},
+		{"m", []interface{}{int64(1)}},
+		{"int", int32(3)},
+		{"std", NewOrderedMapFromKVPairs([]*KVPair{{"a", int32(1)}, {"b", int32(2)}})},
+		{"time", bson.DateTime(1000)},
+	})
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Fatalf("BSON conversions: %#v not deeply equal to expected %#v", decoded, expected)
+	}
+}
+
+// the driver uses the methods for an OrderedMap nested in its own types too
+func TestBSONWithDriver(t *testing.T) {
+	type record struct {
+		Name string      `bson:"name"`
+		Doc  *OrderedMap `bson:"doc"`
+	}
+	in := record{"r", NewOrderedMapFromKVPairs([]*KVPair{{"z", "1"}, {"a", bson.D{{Key: "y", Value: 1}, {Key: "b", Value: 2}}}})}
+	b, err := bson.Marshal(in)
+	if err != nil {
+		t.Fatalf("bson.Marshal: %v", err)
+	}
+	var out record
+	if err := bson.Unmarshal(b, &out); err != nil {
+		t.Fatalf("bson.Unmarshal: %v", err)
+	}
+	if keys := out.Doc.Keys(); !reflect.DeepEqual(keys, []string{"z", "a"}) {
+		t.Fatalf("BSON with driver: keys order not kept %q", keys)
+	}
+	if nested, _ := out.Doc.GetOrderedMap("a"); nested == nil || !reflect.DeepEqual(nested.Keys(), []string{"y", "b"}) {
+		t.Fatalf("BSON with driver: nested keys order not kept %v", out.Doc.Get("a"))
+	}
+}
+
+func TestUnmarshalBSONHistory(t *testing.T) {
+	b, err := NewOrderedMapFromKVPairs([]*KVPair{{"b", "x"}, {"a", int32(1)}}).MarshalBSON()
+	if err != nil {
+		t.Fatalf("MarshalBSON: %v", err)
+	}
+	om := NewOrderedMap()
+	om.EnableHistory()
+	if err := om.UnmarshalBSON(b); err != nil {
+		t.Fatalf("UnmarshalBSON: %v", err)
+	}
+	if h := om.History(); len(h) != 0 {
+		t.Fatalf("History: UnmarshalBSON should not be recorded, got %v", h)
+	}
+	if !reflect.DeepEqual(om.Keys(), []string{"b", "a"}) || om.Get("a") != int32(1) {
+		t.Fatalf("UnmarshalBSON: got %v", om)
+	}
+}
+
+func TestBSONInvalid(t *testing.T) {
+	if _, err := NewOrderedMapFromKVPairs([]*KVPair{{"c", make(chan int)}}).MarshalBSON(); err == nil {
+		t.Fatal("MarshalBSON: expecting error for an unsupported type")
+	}
+
+	good, _ := NewOrderedMapFromKVPairs([]*KVPair{{"a", "b"}}).MarshalBSON()
+	for _, data := range [][]byte{
+		nil,
+		good[:len(good)-1],
+		append(append([]byte{}, good...), 0),
+		[]byte("\x0c\x00\x00\x00\x02a\x00\x09\x00\x00\x00\x00"),
+	} {
+		if err := NewOrderedMap().UnmarshalBSON(data); err == nil {
+			t.Fatalf("UnmarshalBSON: expecting error for %q", data)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package ordered
+
+import "reflect"
+
+// the JSON of a map last written by MarshalJSON, nil once the map is changed
+type marshalCache struct {
+	b []byte
+}
+
+// keep the JSON written by MarshalJSON for the map and each OrderedMap nested in it, so the next
+// MarshalJSON reuses the bytes of the subtrees unchanged since, such as for re-sending a big object
+// after changing one field; a change by any method of a map drops its bytes. The values changed
+// without a method of their map, such as setting an element of an array got by Get, are not noticed
+// and need Set to be called again. A map holding a value other than a scalar, an array, an OrderedMap or
+// a map[string]interface{} is never reused, as its bytes can't be known unchanged. MarshalWithOptions
+// doesn't use the cache
+func (om *OrderedMap) EnableMarshalCache() {
+	if om.cache == nil {
+		om.cache = &marshalCache{}
+	}
+}
+
+// write the map with the cached bytes when unchanged, caching its bytes otherwise
+func (e *encoder) encodeCached(om *OrderedMap) error {
+	om.EnableMarshalCache()
+	if e.isClean(om) {
+		e.buf = append(e.buf, om.cache.b...)
+		return nil
+	}
+	start := len(e.buf)
+	e.cached++
+	err := e.writeMap(om)
+	e.cached--
+	if err != nil {
+		return err
+	}
+	om.cache.b = append([]byte(nil), e.buf[start:]...)
+	return nil
+}
+
+// whether the cached bytes of the map, and of every map nested in it, are still valid
+func (e *encoder) isClean(om *OrderedMap) bool {
+	if om.cache == nil || om.cache.b == nil {
+		return false
+	}
+	if clean, ok := e.clean[om]; ok {
+		return clean
+	}
+	clean := true
+	for el := om.l.Front(); el != nil && clean; el = el.Next() {
+		clean = e.isValueClean(om.m[el.Value.(string)])
+	}
+	if e.clean == nil {
+		e.clean = make(map[*OrderedMap]bool)
+	}
+	e.clean[om] = clean
+	return clean
+}
+
+// the maps nested in arrays and map[string]interface{} values are checked, any other value that is no
+// scalar, such as a struct or a pointer, may hold a map changed since, so it is never clean
+func (e *encoder) isValueClean(v interface{}) bool {
+	var arr []interface{}
+	switch v := v.(type) {
+	case nil:
+		return true
+	case *OrderedMap:
+		return v == nil || e.isClean(v)
+	case []interface{}:
+		arr = v
+	case MultiValue:
+		arr = v
+	case map[string]interface{}:
+		for _, elem := range v {
+			if !e.isValueClean(elem) {
+				return false
+			}
+		}
+		return true
+	default:
+		switch reflect.ValueOf(v).Kind() {
+		case reflect.Bool, reflect.String,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+			reflect.Float32, reflect.Float64:
+			return true
+		}
+		return false
+	}
+	for _, elem := range arr {
+		if !e.isValueClean(elem) {
+			return false
+		}
+	}
+	return true
+}
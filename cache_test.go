@@ -0,0 +1,93 @@
+package ordered
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMarshalCache(t *testing.T) {
+	om := NewOrderedMap()
+	data := `{"a": 1, "nested": {"b": {"c": [1, 2]}, "d": "x"}, "list": [{"e": true}]}`
+	if err := json.Unmarshal([]byte(data), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	expected, err := om.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON: %v", err)
+	}
+	om.EnableMarshalCache()
+
+	marshal := func() string {
+		b, err := json.Marshal(om)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		return string(b)
+	}
+	if s := marshal(); s != string(expected) {
+		t.Fatalf("MarshalCache: got %s, expected %s", s, expected)
+	}
+	nested, _ := om.GetOrderedMap("nested")
+	b, _ := nested.GetOrderedMap("b")
+	list, _ := om.GetOrderedMapSlice("list")
+	if nested.cache == nil || b.cache == nil || list[0].cache == nil || string(b.cache.b) != `{"c":[1,2]}` {
+		t.Fatal("MarshalCache: expect the nested maps cached")
+	}
+	if s := marshal(); s != string(expected) {
+		t.Fatalf("MarshalCache: got %s, expected %s", s, expected)
+	}
+
+	// replace the cached bytes to see they are reused
+	om.cache.b = []byte(`{"cached":true}`)
+	if s := marshal(); s != `{"cached":true}` {
+		t.Fatalf("MarshalCache: expect the cached bytes reused when nothing changed, got %s", s)
+	}
+	nested.cache.b = []byte(`{"nested":"cached"}`)
+	list[0].Set("e", false)
+	if s := marshal(); s != `{"a":1,"nested":{"nested":"cached"},"list":[{"e":false}]}` {
+		t.Fatalf("MarshalCache: expect unchanged subtrees reused, got %s", s)
+	}
+
+	b.Set("c", "changed")
+	expected = []byte(`{"a":1,"nested":{"b":{"c":"changed"},"d":"x"},"list":[{"e":false}]}`)
+	if s := marshal(); s != string(expected) {
+		t.Fatalf("MarshalCache: expect the cache dropped after a nested Set, got %s", s)
+	}
+	if s := marshal(); s != string(expected) {
+		t.Fatalf("MarshalCache: got %s, expected %s", s, expected)
+	}
+	nested.Set("new", NewOrderedMapFromKVPairs([]*KVPair{{"f", 1}}))
+	if s := marshal(); s != `{"a":1,"nested":{"b":{"c":"changed"},"d":"x","new":{"f":1}},"list":[{"e":false}]}` {
+		t.Fatalf("MarshalCache: got %s after adding a map", s)
+	}
+	b.cache.b = []byte(`{"c":"cached"}`)
+	if out, _ := om.MarshalWithOptions(MarshalOptions{}); string(out) != `{"a":1,"nested":{"b":{"c":"changed"},"d":"x","new":{"f":1}},"list":[{"e":false}]}` {
+		t.Fatalf("MarshalWithOptions: should not use the cache, got %s", out)
+	}
+}
+
+func TestMarshalCacheNonScalarValues(t *testing.T) {
+	child := NewOrderedMapFromKVPairs([]*KVPair{{"a", 1}})
+	om := NewOrderedMapFromKVPairs([]*KVPair{{"x", map[string]interface{}{"c": child}}})
+	om.EnableMarshalCache()
+	if b, _ := json.Marshal(om); string(b) != `{"x":{"c":{"a":1}}}` {
+		t.Fatalf("MarshalCache: got %s", b)
+	}
+	child.Set("a", 2)
+	if b, _ := json.Marshal(om); string(b) != `{"x":{"c":{"a":2}}}` {
+		t.Fatalf("MarshalCache: expect a change of a map inside a map[string]interface{} noticed, got %s", b)
+	}
+
+	type holder struct {
+		M *OrderedMap `json:"m"`
+	}
+	om = NewOrderedMapFromKVPairs([]*KVPair{{"s", holder{child}}, {"n", 1}})
+	om.EnableMarshalCache()
+	if b, _ := json.Marshal(om); string(b) != `{"s":{"m":{"a":2}},"n":1}` {
+		t.Fatalf("MarshalCache: got %s", b)
+	}
+	child.Set("a", 3)
+	if b, _ := json.Marshal(om); string(b) != `{"s":{"m":{"a":3}},"n":1}` {
+		t.Fatalf("MarshalCache: expect a struct value never reused from the cache, got %s", b)
+	}
+}
@@ -0,0 +1,122 @@
+package ordered
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Get the comment attached to the key, such as decoded with DecodeOptions.Comments; empty if none
+func (om *OrderedMap) Comment(key string) string {
+	if meta, ok := om.meta[key]; ok {
+		return meta.comment
+	}
+	return ""
+}
+
+// attach a comment to an existing key, written before the key by MarshalWithOptions with
+// MarshalOptions.Comments, lines separated by '\n'; an empty comment removes it
+func (om *OrderedMap) SetComment(key, comment string) {
+	om.modify("SetComment")
+	if _, ok := om.m[key]; !ok {
+		return
+	}
+	if comment == "" {
+		if meta, ok := om.meta[key]; ok {
+			meta.comment = ""
+		}
+		return
+	}
+	om.metaOf(key).comment = comment
+}
+
+// a comment of the input, at the offsets [start, end); trailing when it ends the line of some JSON
+type comment struct {
+	start, end int64
+	text       string
+	trailing   bool
+}
+
+// blank out the "//" line and "/* */" block comments with spaces, keeping newlines,
+// so the offsets of the remaining JSON are unchanged
+func stripComments(data []byte) ([]byte, []comment, error) {
+	clean := make([]byte, len(data))
+	copy(clean, data)
+	var comments []comment
+	for i := 0; i < len(clean); {
+		switch {
+		case clean[i] == '"':
+			// skip over strings, a "//" inside is not a comment
+			for i++; i < len(clean) && clean[i] != '"'; i++ {
+				if clean[i] == '\\' {
+					i++
+				}
+			}
+			i++
+		case bytes.HasPrefix(clean[i:], []byte("//")):
+			end := bytes.IndexByte(clean[i:], '\n')
+			if end < 0 {
+				end = len(clean)
+			} else {
+				end += i
+			}
+			comments = append(comments, comment{int64(i), int64(end), strings.TrimSpace(string(clean[i+2 : end])), false})
+			blank(clean[i:end])
+			i = end
+		case bytes.HasPrefix(clean[i:], []byte("/*")):
+			end := bytes.Index(clean[i+2:], []byte("*/"))
+			if end < 0 {
+				return nil, nil, fmt.Errorf("unterminated comment at offset %d", i)
+			}
+			end += i + 4
+			lines := strings.Split(string(clean[i+2:end-2]), "\n")
+			for j := range lines {
+				lines[j] = strings.TrimSpace(lines[j])
+			}
+			comments = append(comments, comment{int64(i), int64(end), strings.TrimSpace(strings.Join(lines, "\n")), false})
+			blank(clean[i:end])
+			i = end
+		default:
+			i++
+		}
+	}
+	for i := range comments {
+		comments[i].trailing = isTrailing(clean, comments[i])
+	}
+	return clean, comments, nil
+}
+
+// whether some JSON is before the comment on its line and nothing but the closing of the JSON after,
+// such as `"a": 1, // about a` but not `"a": 1, /* about b */ "b": 2`
+func isTrailing(clean []byte, c comment) bool {
+	for i := c.end; i < int64(len(clean)) && clean[i] != '\n'; i++ {
+		if !bytes.ContainsRune([]byte(" \t\r,]}"), rune(clean[i])) {
+			return false
+		}
+	}
+	for i := c.start - 1; i >= 0 && clean[i] != '\n'; i-- {
+		if clean[i] != ' ' && clean[i] != '\t' && clean[i] != '\r' {
+			return true
+		}
+	}
+	return false
+}
+
+// add a comment after the existing one of the key, on its own line
+func (om *OrderedMap) appendComment(key, comment string) {
+	if comment == "" {
+		return
+	}
+	if c := om.Comment(key); c != "" {
+		comment = c + "\n" + comment
+	}
+	om.SetComment(key, comment)
+}
+
+func blank(b []byte) {
+	for i := range b {
+		if b[i] != '\n' {
+			b[i] = ' '
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package ordered
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const json5Config = `{
+  // the service name
+  "name": "app",
+  "db": {
+    // where to connect
+    // in host:port form
+    "addr": "localhost:5432",
+    "pool": 4,
+    "url": "http://example.com/*not a comment*/"
+  },
+  /* block
+     comment */
+  "debug": false,
+  "tags": ["a", // inside an array
+    "b"]
+  // dropped, not before any key
+}`
+
+func TestCommentsRoundTrip(t *testing.T) {
+	om := NewOrderedMap()
+	if err := json.Unmarshal([]byte(json5Config), om); err == nil {
+		t.Fatal("Unmarshal OrderedMap: expecting error for comments in strict mode")
+	}
+
+	om = NewOrderedMap()
+	if err := om.UnmarshalWithOptions([]byte(json5Config), DecodeOptions{Comments: true}); err != nil {
+		t.Fatalf("UnmarshalWithOptions: %v", err)
+	}
+	if c := om.Comment("name"); c != "the service name" {
+		t.Fatalf("Comment name: %q", c)
+	}
+	db := om.Get("db").(*OrderedMap)
+	if c := db.Comment("addr"); c != "where to connect\nin host:port form" {
+		t.Fatalf("Comment db.addr: %q", c)
+	}
+	if c := db.Comment("pool"); c != "" {
+		t.Fatalf("Comment db.pool: expect no comment but got %q", c)
+	}
+	if url := db.Get("url"); url != "http://example.com/*not a comment*/" {
+		t.Fatalf("db.url: %q", url)
+	}
+
+	b, err := om.MarshalWithOptions(MarshalOptions{Indent: "  ", Comments: true})
+	if err != nil {
+		t.Fatalf("MarshalWithOptions: %v", err)
+	}
+	const expected = `{
+  // the service name
+  "name": "app",
+  "db": {
+    // where to connect
+    // in host:port form
+    "addr": "localhost:5432",
+    "pool": 4,
+    "url": "http://example.com/*not a comment*/"
+  },
+  // block
+  // comment
+  "debug": false,
+  "tags": [
+    "a",
+    "b"
+  ]
+}`
+	if string(b) != expected {
+		t.Fatalf("MarshalWithOptions comments:\nhave: %s\nwant: %s", b, expected)
+	}
+
+	// decoding the output again gives the same comments
+	again := NewOrderedMap()
+	if err := again.UnmarshalWithOptions(b, DecodeOptions{Comments: true}); err != nil {
+		t.Fatalf("UnmarshalWithOptions again: %v", err)
+	}
+	b2, err := again.MarshalWithOptions(MarshalOptions{Indent: "  ", Comments: true})
+	if err != nil || string(b2) != expected {
+		t.Fatalf("MarshalWithOptions again: %s %v", b2, err)
+	}
+
+	// without the option the output is plain JSON
+	b, err = json.Marshal(om)
+	if err != nil {
+		t.Fatalf("Marshal OrderedMap: %v", err)
+	}
+	if expected := `{"name":"app","db":{"addr":"localhost:5432","pool":4,"url":"http://example.com/*not a comment*/"},"debug":false,"tags":["a","b"]}`; string(b) != expected {
+		t.Fatalf("Marshal OrderedMap: %s not equal to expected %s", b, expected)
+	}
+}
+
+func TestSetCommentCompact(t *testing.T) {
+	om := NewOrderedMapFromKVPairs([]*KVPair{{"a", 1}, {"b", 2}})
+	om.SetComment("b", "the b")
+	om.SetComment("missing", "ignored")
+	b, err := om.MarshalWithOptions(MarshalOptions{Comments: true})
+	if err != nil {
+		t.Fatalf("MarshalWithOptions: %v", err)
+	}
+	if expected := `{"a":1,/* the b */"b":2}`; string(b) != expected {
+		t.Fatalf("MarshalWithOptions compact comments: %s not equal to expected %s", b, expected)
+	}
+
+	om.SetComment("b", "")
+	if c := om.Comment("b"); c != "" {
+		t.Fatalf("Comment b: expect removed but got %q", c)
+	}
+	if clone := om.Clone(); clone.Comment("a") != "" {
+		t.Fatal("Clone: unexpected comment")
+	}
+}
+
+func TestUnterminatedComment(t *testing.T) {
+	om := NewOrderedMap()
+	if err := om.UnmarshalWithOptions([]byte(`{"a": 1 /* open`), DecodeOptions{Comments: true}); err == nil {
+		t.Fatal("UnmarshalWithOptions: expecting error for an unterminated comment")
+	}
+}
+
+func TestTrailingComments(t *testing.T) {
+	data := `{ // about the object
+  "a": 1, // about a
+  // about b
+  "b": {"c": true}, /* more about b */
+  "d": 2, /* about e */ "e": 3,
+  "f": [1, 2] // about f
+}`
+	om := NewOrderedMap()
+	if err := om.UnmarshalWithOptions([]byte(data), DecodeOptions{Comments: true}); err != nil {
+		t.Fatalf("UnmarshalWithOptions: %v", err)
+	}
+	for key, expected := range map[string]string{
+		"a": "about the object\nabout a",
+		"b": "about b\nmore about b",
+		"d": "",
+		"e": "about e",
+		"f": "about f",
+	} {
+		if c := om.Comment(key); c != expected {
+			t.Fatalf("Comment %s: %q, expected %q", key, c, expected)
+		}
+	}
+
+	b, err := om.MarshalWithOptions(MarshalOptions{Indent: "  ", Comments: true})
+	if err != nil {
+		t.Fatalf("MarshalWithOptions: %v", err)
+	}
+	const expected = `{
+  // about the object
+  // about a
+  "a": 1,
+  // about b
+  // more about b
+  "b": {
+    "c": true
+  },
+  "d": 2,
+  // about e
+  "e": 3,
+  // about f
+  "f": [
+    1,
+    2
+  ]
+}`
+	if string(b) != expected {
+		t.Fatalf("MarshalWithOptions trailing comments:\nhave: %s\nwant: %s", b, expected)
+	}
+
+	// the compact output keeps the comments of each key too
+	b, _ = om.MarshalWithOptions(MarshalOptions{Comments: true})
+	again := NewOrderedMap()
+	if err := again.UnmarshalWithOptions(b, DecodeOptions{Comments: true}); err != nil {
+		t.Fatalf("UnmarshalWithOptions compact: %v", err)
+	}
+	for _, key := range om.Keys() {
+		if again.Comment(key) != om.Comment(key) {
+			t.Fatalf("Comment %s: %q after a compact round trip, expected %q", key, again.Comment(key), om.Comment(key))
+		}
+	}
+}
+
+func TestTrailingCommentEmptyKey(t *testing.T) {
+	om := NewOrderedMap()
+	if err := om.UnmarshalWithOptions([]byte("{\"\": 1, // about empty\n \"b\": 2 // about b\n}"), DecodeOptions{Comments: true}); err != nil {
+		t.Fatalf("UnmarshalWithOptions: %v", err)
+	}
+	if c := om.Comment(""); c != "about empty" {
+		t.Fatalf("Comment of the empty key: %q", c)
+	}
+	if c := om.Comment("b"); c != "about b" {
+		t.Fatalf("Comment b: %q", c)
+	}
+}
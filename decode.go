@@ -0,0 +1,464 @@
+package ordered
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// the options for UnmarshalWithOptions, the zero value decodes the same as UnmarshalJSON
+type DecodeOptions struct {
+	// keep every value of a key appearing more than once in the same object, as a MultiValue
+	// in order of appearance at the position of its first appearance, instead of keeping only the
+	// last value; keys appearing once keep their plain value
+	PreserveDuplicates bool
+	// decode only this many levels of nesting, the top-level object being the level 1; any object
+	// or array beyond is kept as a json.RawMessage of its bytes. Zero means no limit
+	MaxDecodeDepth int
+	// accept JSON5 style "//" line and "/* */" block comments, the comments before a key are
+	// attached to the key (see Comment) and joined by '\n' when more than one, and so are the
+	// comments on the same line after a member, such as `"a": 1, // about a`, to the key of the
+	// member; comments at any other place, such as on their own line before the closing '}', are dropped
+	Comments bool
+	// the max size in bytes of a single value (a string, a number, or a raw object or array kept by
+	// MaxDecodeDepth), a larger one fails the decoding; this also stops a reader being buffered much
+	// beyond the size while reading a value, bounding the memory to decode a huge input from
+	// NewOrderedMapFromReader. Zero means no limit
+	MaxValueSize int
+	// keep the bytes of each key as quoted in the input when they differ from the normalized
+	// quoting, such as "\u00e9" for "é", and marshal the key with them again for a byte exact round trip
+	RawKeys bool
+	// accept a top-level null, as some upstreams send where an object is expected, leaving the map
+	// empty instead of failing the decoding
+	AllowNull bool
+	// when set, called for every number decoded, its result is stored instead of the json.Number,
+	// such as a *big.Float or a decimal type avoiding the float imprecision; an error fails the decoding.
+	// The numbers inside a raw value kept by MaxDecodeDepth are left as they are
+	NumberHook func(json.Number) (interface{}, error)
+	// decode every key in lower case, such as for case-inconsistent sources; the keys equal once in
+	// lower case are duplicate keys, so by default the last value wins at the first position (see
+	// DuplicateKeys). RawKeys doesn't apply then
+	LowercaseKeys bool
+	// accept an input starting with a byte order mark, such as files saved by some editors: a UTF-8 one
+	// is stripped, a UTF-16 LE or BE one is stripped and the rest transcoded to UTF-8; the input must be
+	// valid UTF-8 then, instead of invalid bytes being silently replaced by U+FFFD
+	DetectEncoding bool
+	// the max size in bytes of the whole input, a larger one fails the decoding; with
+	// NewOrderedMapFromReader no more than this is read from the reader, bounding what a hostile
+	// stream, such as a decompression bomb, can make the decoding consume. Zero means no limit
+	MaxInputSize int
+}
+
+// how a key appearing more than once in the same JSON object is decoded
+type DuplicateKeyPolicy int
+
+const (
+	// keep the last value, at the position of the first appearance
+	KeepLast DuplicateKeyPolicy = iota
+	// keep the first value, ignoring the others
+	KeepFirst
+	// fail the decoding
+	Error
+	// keep every value as a MultiValue at the position of the first appearance, see DecodeOptions.PreserveDuplicates
+	Combine
+)
+
+// the DuplicateKeyPolicy of every decoding of this package, UnmarshalJSON and the others alike; it is
+// read without synchronization, so set it at the start of the program. DecodeOptions.PreserveDuplicates
+// overrides it with Combine for one decoding
+var DuplicateKeys = KeepLast
+
+// the values of a duplicate key decoded with DecodeOptions.PreserveDuplicates, in order of appearance;
+// a dedicated type so it is never confused with a JSON array value, it marshals as a JSON array
+type MultiValue []interface{}
+
+type decoder struct {
+	*json.Decoder
+	opts  DecodeOptions
+	depth int // the nesting level of the object or array being parsed
+
+	comments []comment // of the input, in order of offset
+	next     int       // the first comment not yet attached or skipped
+
+	data []byte // the whole input, for DecodeOptions.RawKeys
+}
+
+// the quoted key just read from the offset, nil if it is the same as the normalized quoting
+func (dec *decoder) rawKey(offset int64, key string) []byte {
+	raw := dec.data[offset:dec.InputOffset()]
+	raw = raw[bytes.IndexByte(raw, '"'):]
+	if string(raw) == string(appendString(nil, key)) {
+		return nil
+	}
+	return append([]byte(nil), raw...)
+}
+
+// join the comments from the offset to the end of the token just read, the ones still on the line
+// of the offset, such as "// about a" after `"a": 1,`, apart as trailing
+func (dec *decoder) commentsSince(offset int64) (trailing, leading string) {
+	end := dec.InputOffset()
+	var trailings, texts []string
+	for ; dec.next < len(dec.comments) && dec.comments[dec.next].start < end; dec.next++ {
+		if c := dec.comments[dec.next]; c.start >= offset {
+			if c.trailing && len(texts) == 0 {
+				trailings = append(trailings, c.text)
+			} else {
+				texts = append(texts, c.text)
+			}
+		}
+	}
+	return strings.Join(trailings, "\n"), strings.Join(texts, "\n")
+}
+
+func newDecoder(r io.Reader, opts DecodeOptions) *decoder {
+	d := &decoder{opts: opts}
+	if opts.MaxValueSize > 0 {
+		r = &valueSizeReader{r: r, dec: d}
+	}
+	d.Decoder = json.NewDecoder(r)
+	d.UseNumber()
+	return d
+}
+
+func (dec *decoder) errValueSize() error {
+	return fmt.Errorf("JSON value at offset %d exceeds the MaxValueSize of %d bytes", dec.InputOffset(), dec.opts.MaxValueSize)
+}
+
+// the json.Decoder reads more only when the buffered input doesn't complete the value being read,
+// so refuse to read more once the input buffered since the last complete token is beyond the limit
+type valueSizeReader struct {
+	r    io.Reader
+	dec  *decoder
+	read int64
+}
+
+// spaces and separators buffered along with a value
+const valueSizeSlack = 512
+
+func (vr *valueSizeReader) Read(p []byte) (int, error) {
+	if vr.read-vr.dec.InputOffset() > int64(vr.dec.opts.MaxValueSize)+valueSizeSlack {
+		return 0, vr.dec.errValueSize()
+	}
+	n, err := vr.r.Read(p)
+	vr.read += int64(n)
+	return n, err
+}
+
+func errInputSize(max int) error {
+	return fmt.Errorf("JSON input exceeds the MaxInputSize of %d bytes", max)
+}
+
+// fail a read beyond DecodeOptions.MaxInputSize, probing for a byte more once the limit is reached
+// so an input of exactly the limit still succeeds
+type inputSizeReader struct {
+	r    io.Reader
+	max  int
+	left int64
+}
+
+func (ir *inputSizeReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if ir.left <= 0 {
+		n, err := ir.r.Read(p[:1])
+		if n > 0 {
+			return 0, errInputSize(ir.max)
+		}
+		return 0, err
+	}
+	if int64(len(p)) > ir.left {
+		p = p[:ir.left]
+	}
+	n, err := ir.r.Read(p)
+	ir.left -= int64(n)
+	return n, err
+}
+
+// check the size of a value just read against DecodeOptions.MaxValueSize
+func (dec *decoder) checkValueSize(v interface{}) error {
+	if dec.opts.MaxValueSize <= 0 {
+		return nil
+	}
+	var size int
+	switch v := v.(type) {
+	case string:
+		size = len(v)
+	case json.Number:
+		size = len(v)
+	case json.RawMessage:
+		size = len(v)
+	}
+	if size > dec.opts.MaxValueSize {
+		return dec.errValueSize()
+	}
+	return nil
+}
+
+// read the next value, an object or array beyond DecodeOptions.MaxDecodeDepth is kept raw
+func (dec *decoder) value() (interface{}, error) {
+	if dec.opts.MaxDecodeDepth > 0 && dec.depth >= dec.opts.MaxDecodeDepth {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		if err := dec.checkValueSize(raw); err != nil {
+			return nil, err
+		}
+		if raw[0] == '{' || raw[0] == '[' {
+			return raw, nil
+		}
+		// a scalar is decoded the same as usual
+		var v interface{}
+		d := json.NewDecoder(bytes.NewReader(raw))
+		d.UseNumber()
+		if err := d.Decode(&v); err != nil {
+			return nil, err
+		}
+		return dec.number(v)
+	}
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if err = dec.checkValueSize(t); err != nil {
+		return nil, err
+	}
+	if _, ok := t.(json.Number); ok {
+		return dec.number(t)
+	}
+	return handledelim(t, dec)
+}
+
+// apply DecodeOptions.NumberHook to a scalar value just read, if it is a number
+func (dec *decoder) number(v interface{}) (interface{}, error) {
+	num, ok := v.(json.Number)
+	if !ok || dec.opts.NumberHook == nil {
+		return v, nil
+	}
+	res, err := dec.opts.NumberHook(num)
+	if err != nil {
+		return nil, fmt.Errorf("number %s at offset %d: %v", num, dec.InputOffset(), err)
+	}
+	return res, nil
+}
+
+// same as UnmarshalJSON, but controlled by the options
+func (om *OrderedMap) UnmarshalWithOptions(data []byte, opts DecodeOptions) error {
+	om.reset()
+	return om.unmarshal(data, opts)
+}
+
+// unmarshal into the map merging with the existing content rather than resetting it, such as defaults;
+// an existing key keeps its position but takes the new value, new keys are appended in the order of data
+func (om *OrderedMap) UnmarshalMerge(data []byte) error {
+	om.modify("UnmarshalMerge")
+	if om.m == nil {
+		om.reset()
+	}
+	return om.unmarshal(data, DecodeOptions{})
+}
+
+// Create a new OrderedMap decoded from the JSON object read from r, streaming the input through a
+// json.Decoder rather than reading it in full first, only the Comments, RawKeys and DetectEncoding options
+// need the whole input
+func NewOrderedMapFromReader(r io.Reader, opts DecodeOptions) (*OrderedMap, error) {
+	om := NewOrderedMap()
+	if opts.MaxInputSize > 0 {
+		r = &inputSizeReader{r: r, max: opts.MaxInputSize, left: int64(opts.MaxInputSize)}
+	}
+	if opts.Comments || opts.RawKeys || opts.DetectEncoding {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return om, om.unmarshal(data, opts)
+	}
+	return om, om.decode(newDecoder(r, opts))
+}
+
+func (om *OrderedMap) unmarshal(data []byte, opts DecodeOptions) error {
+	if opts.MaxInputSize > 0 && len(data) > opts.MaxInputSize {
+		return errInputSize(opts.MaxInputSize)
+	}
+	if opts.DetectEncoding {
+		var err error
+		if data, err = toUTF8(data); err != nil {
+			return err
+		}
+	}
+	var comments []comment
+	if opts.Comments {
+		var err error
+		if data, comments, err = stripComments(data); err != nil {
+			return err
+		}
+	}
+	dec := newDecoder(bytes.NewReader(data), opts)
+	dec.comments = comments
+	if opts.RawKeys {
+		dec.data = data
+	}
+	return om.decode(dec)
+}
+
+// strip the byte order mark of data, transcoding UTF-16 to UTF-8, for DecodeOptions.DetectEncoding
+func toUTF8(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		data = data[3:]
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}), bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		order := binary.ByteOrder(binary.LittleEndian)
+		if data[0] == 0xFE {
+			order = binary.BigEndian
+		}
+		data = data[2:]
+		if len(data)%2 != 0 {
+			return nil, fmt.Errorf("invalid UTF-16 input: odd length of %d bytes after the BOM", len(data))
+		}
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			units[i] = order.Uint16(data[2*i:])
+		}
+		var buf bytes.Buffer
+		for _, r := range utf16.Decode(units) {
+			buf.WriteRune(r)
+		}
+		return buf.Bytes(), nil
+	}
+	if i := invalidUTF8(data); i >= 0 {
+		return nil, fmt.Errorf("invalid UTF-8 input at offset %d", i)
+	}
+	return data, nil
+}
+
+// the offset of the first invalid UTF-8 byte of data, -1 if none
+func invalidUTF8(data []byte) int {
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size == 1 {
+			return i
+		}
+		i += size
+	}
+	return -1
+}
+
+func (om *OrderedMap) decode(dec *decoder) error {
+	// must open with a delim token '{'
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	// a null allowed leaves the map as is
+	if t != nil || !dec.opts.AllowNull {
+		if delim, ok := t.(json.Delim); !ok || delim != '{' {
+			return fmt.Errorf("expect JSON object open with '{'")
+		}
+		dec.depth = 1
+		if err = om.parseobject(dec); err != nil {
+			return err
+		}
+	}
+
+	t, err = dec.Token()
+	if err == nil {
+		return fmt.Errorf("expect end of JSON object but got more token: %T: %v", t, t)
+	} else if err != io.EOF {
+		// such as the MaxInputSize crossed by trailing bytes
+		return err
+	}
+
+	return nil
+}
+
+// decode any JSON value, for endpoints returning either an object or an array: an *OrderedMap for an
+// object, a []interface{} for an array, objects inside keeping their keys order, or the scalar itself,
+// numbers as json.Number, same as the values of UnmarshalJSON
+func DecodeValue(data []byte) (interface{}, error) {
+	dec := newDecoder(bytes.NewReader(data), DecodeOptions{})
+	v, err := dec.value()
+	if err != nil {
+		return nil, err
+	}
+	t, err := dec.Token()
+	if err == nil {
+		return nil, fmt.Errorf("expect end of JSON value but got more token: %T: %v", t, t)
+	} else if err != io.EOF {
+		return nil, err
+	}
+	return v, nil
+}
+
+// decode a top-level JSON array of objects from r one element at a time, calling fn with the index
+// and the element decoded, so a huge array is never held in memory; an error returned by fn stops
+// the decoding and is returned as is, a malformed element fails with its index
+func DecodeArrayStream(r io.Reader, fn func(index int, om *OrderedMap) error) error {
+	dec := newDecoder(r, DecodeOptions{})
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := t.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("expect JSON array open with '['")
+	}
+	for i := 0; dec.More(); i++ {
+		om := NewOrderedMap()
+		if t, err = dec.Token(); err != nil {
+			return fmt.Errorf("array element %d: %v", i, err)
+		}
+		if delim, ok := t.(json.Delim); !ok || delim != '{' {
+			return fmt.Errorf("array element %d: expect JSON object open with '{'", i)
+		}
+		dec.depth = 1
+		if err = om.parseobject(dec); err != nil {
+			return fmt.Errorf("array element %d: %v", i, err)
+		}
+		if err = fn(i, om); err != nil {
+			return err
+		}
+	}
+	if t, err = dec.Token(); err != nil {
+		return err
+	}
+	if delim, ok := t.(json.Delim); !ok || delim != ']' {
+		return fmt.Errorf("expect JSON array close with ']'")
+	}
+	if t, err = dec.Token(); err == nil {
+		return fmt.Errorf("expect end of JSON array but got more token: %T: %v", t, t)
+	} else if err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// decode a NDJSON (newline-delimited JSON) stream, one JSON object per line, each keeping
+// its keys order; blank lines are skipped, a malformed line fails with its line number
+func DecodeNDJSON(r io.Reader) ([]*OrderedMap, error) {
+	var (
+		res = make([]*OrderedMap, 0)
+		br  = bufio.NewReader(r)
+	)
+	for lineno := 1; ; lineno++ {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return res, err
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			om := NewOrderedMap()
+			if uerr := om.UnmarshalJSON(line); uerr != nil {
+				return res, fmt.Errorf("NDJSON line %d: %v", lineno, uerr)
+			}
+			res = append(res, om)
+		}
+		if err == io.EOF {
+			return res, nil
+		}
+	}
+}
@@ -0,0 +1,630 @@
+package ordered
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode/utf16"
+)
+
+func TestDecodeNDJSON(t *testing.T) {
+	const stream = `{"b":1,"a":2}
+{"name":"second","tags":["x","y"]}
+{"z":{"y":true,"x":null}}`
+	expected := []*OrderedMap{
+		NewOrderedMapFromKVPairs([]*KVPair{{"b", json.Number("1")}, {"a", json.Number("2")}}),
+		NewOrderedMapFromKVPairs([]*KVPair{{"name", "second"}, {"tags", []interface{}{"x", "y"}}}),
+		NewOrderedMapFromKVPairs([]*KVPair{{"z", NewOrderedMapFromKVPairs([]*KVPair{{"y", true}, {"x", nil}})}}),
+	}
+
+	maps, err := DecodeNDJSON(strings.NewReader(stream))
+	if err != nil {
+		t.Fatalf("DecodeNDJSON: %v", err)
+	}
+	if !reflect.DeepEqual(maps, expected) {
+		t.Fatalf("DecodeNDJSON: %#v not deeply equal to expected %#v", maps, expected)
+	}
+}
+
+func TestDecodeNDJSONBlankLine(t *testing.T) {
+	const stream = "{\"a\":1}\n\n  \t\n{\"b\":2}\n"
+	maps, err := DecodeNDJSON(strings.NewReader(stream))
+	if err != nil {
+		t.Fatalf("DecodeNDJSON: %v", err)
+	}
+	if len(maps) != 2 || !maps[0].Has("a") || !maps[1].Has("b") {
+		t.Fatalf("DecodeNDJSON: expect 2 objects skipping blank lines but got %#v", maps)
+	}
+}
+
+func TestDecodeNDJSONMalformedLine(t *testing.T) {
+	const stream = "{\"a\":1}\n\n{\"b\":\n{\"c\":3}\n"
+	_, err := DecodeNDJSON(strings.NewReader(stream))
+	if err == nil {
+		t.Fatal("DecodeNDJSON: expecting error")
+	}
+	if !strings.Contains(err.Error(), "line 3") {
+		t.Fatalf("DecodeNDJSON: expect error to report line 3 but got: %v", err)
+	}
+}
+
+func TestUnmarshalPreserveDuplicates(t *testing.T) {
+	data := []byte(`{"a":1,"a":2,"b":3,"c":{"x":true,"x":false},"a":[4]}`)
+
+	om := NewOrderedMap()
+	if err := om.UnmarshalWithOptions(data, DecodeOptions{PreserveDuplicates: true}); err != nil {
+		t.Fatalf("UnmarshalWithOptions: %v", err)
+	}
+	expected := NewOrderedMapFromKVPairs([]*KVPair{
+		{"a", MultiValue{json.Number("1"), json.Number("2"), []interface{}{json.Number("4")}}},
+		{"b", json.Number("3")},
+		{"c", NewOrderedMapFromKVPairs([]*KVPair{{"x", MultiValue{true, false}}})},
+	})
+	if !reflect.DeepEqual(om, expected) {
+		t.Fatalf("UnmarshalWithOptions: %#v not deeply equal to expected %#v", om, expected)
+	}
+
+	b, err := json.Marshal(om)
+	if err != nil {
+		t.Fatalf("Marshal OrderedMap: %v", err)
+	}
+	if expected := `{"a":[1,2,[4]],"b":3,"c":{"x":[true,false]}}`; string(b) != expected {
+		t.Fatalf("Marshal OrderedMap: %s not equal to expected %s", b, expected)
+	}
+
+	// by default the last value wins, at the position of the first appearance
+	om = NewOrderedMap()
+	if err := json.Unmarshal(data, om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	expected = NewOrderedMapFromKVPairs([]*KVPair{
+		{"a", []interface{}{json.Number("4")}},
+		{"b", json.Number("3")},
+		{"c", NewOrderedMapFromKVPairs([]*KVPair{{"x", false}})},
+	})
+	if !reflect.DeepEqual(om, expected) {
+		t.Fatalf("Unmarshal OrderedMap: %#v not deeply equal to expected %#v", om, expected)
+	}
+}
+
+func TestUnmarshalMaxDecodeDepth(t *testing.T) {
+	data := []byte(`{"z": 1, "obj": {"b": {"c": [1, 2]}, "a": "x"}, "arr": [1, {"k": "v"}, [2]], "s": "str"}`)
+
+	om := NewOrderedMap()
+	if err := om.UnmarshalWithOptions(data, DecodeOptions{MaxDecodeDepth: 1}); err != nil {
+		t.Fatalf("UnmarshalWithOptions depth 1: %v", err)
+	}
+	expected := NewOrderedMapFromKVPairs([]*KVPair{
+		{"z", json.Number("1")},
+		{"obj", json.RawMessage(`{"b": {"c": [1, 2]}, "a": "x"}`)},
+		{"arr", json.RawMessage(`[1, {"k": "v"}, [2]]`)},
+		{"s", "str"},
+	})
+	if !reflect.DeepEqual(om, expected) {
+		t.Fatalf("UnmarshalWithOptions depth 1: %#v not deeply equal to expected %#v", om, expected)
+	}
+
+	om = NewOrderedMap()
+	if err := om.UnmarshalWithOptions(data, DecodeOptions{MaxDecodeDepth: 2}); err != nil {
+		t.Fatalf("UnmarshalWithOptions depth 2: %v", err)
+	}
+	expected = NewOrderedMapFromKVPairs([]*KVPair{
+		{"z", json.Number("1")},
+		{"obj", NewOrderedMapFromKVPairs([]*KVPair{
+			{"b", json.RawMessage(`{"c": [1, 2]}`)},
+			{"a", "x"},
+		})},
+		{"arr", []interface{}{json.Number("1"), json.RawMessage(`{"k": "v"}`), json.RawMessage(`[2]`)}},
+		{"s", "str"},
+	})
+	if !reflect.DeepEqual(om, expected) {
+		t.Fatalf("UnmarshalWithOptions depth 2: %#v not deeply equal to expected %#v", om, expected)
+	}
+
+	// the raw values marshal back in place
+	b, err := json.Marshal(om)
+	if err != nil {
+		t.Fatalf("Marshal OrderedMap: %v", err)
+	}
+	if expected := `{"z":1,"obj":{"b":{"c":[1,2]},"a":"x"},"arr":[1,{"k":"v"},[2]],"s":"str"}`; string(b) != expected {
+		t.Fatalf("Marshal OrderedMap: %s not equal to expected %s", b, expected)
+	}
+}
+
+func TestUnmarshalMerge(t *testing.T) {
+	om := NewOrderedMapFromKVPairs([]*KVPair{
+		{"host", "localhost"},
+		{"port", json.Number("80")},
+		{"debug", false},
+	})
+	if err := om.UnmarshalMerge([]byte(`{"tls": true, "port": 443, "name": "app"}`)); err != nil {
+		t.Fatalf("UnmarshalMerge: %v", err)
+	}
+	expected := NewOrderedMapFromKVPairs([]*KVPair{
+		{"host", "localhost"},
+		{"port", json.Number("443")},
+		{"debug", false},
+		{"tls", true},
+		{"name", "app"},
+	})
+	if !reflect.DeepEqual(om, expected) {
+		t.Fatalf("UnmarshalMerge: %#v not deeply equal to expected %#v", om, expected)
+	}
+
+	// while UnmarshalJSON resets the existing content
+	if err := json.Unmarshal([]byte(`{"port": 8080}`), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	expected = NewOrderedMapFromKVPairs([]*KVPair{{"port", json.Number("8080")}})
+	if !reflect.DeepEqual(om, expected) {
+		t.Fatalf("Unmarshal OrderedMap: %#v not deeply equal to expected %#v", om, expected)
+	}
+
+	// a zero value OrderedMap is usable for both
+	var zero OrderedMap
+	if err := zero.UnmarshalMerge([]byte(`{"a": 1}`)); err != nil || !zero.Has("a") {
+		t.Fatalf("UnmarshalMerge zero value: %v", err)
+	}
+	var zero2 OrderedMap
+	if err := json.Unmarshal([]byte(`{"a": 1}`), &zero2); err != nil || !zero2.Has("a") {
+		t.Fatalf("Unmarshal zero value: %v", err)
+	}
+}
+
+// a reader producing a long JSON string value of n bytes, never holding it all
+type longStringReader struct {
+	n, read int
+}
+
+func (lr *longStringReader) Read(p []byte) (int, error) {
+	if lr.read >= lr.n {
+		return 0, io.EOF
+	}
+	i := 0
+	for ; i < len(p) && lr.read < lr.n; i++ {
+		p[i] = 'x'
+		lr.read++
+	}
+	return i, nil
+}
+
+func TestNewOrderedMapFromReader(t *testing.T) {
+	data := `{"b": [1, {"d": "x", "c": null}], "a": "` + strings.Repeat("long ", 1000) + `", "z": true}`
+	expected := NewOrderedMap()
+	if err := json.Unmarshal([]byte(data), expected); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+
+	// one byte at a time, as from a slow network
+	om, err := NewOrderedMapFromReader(iotest.OneByteReader(strings.NewReader(data)), DecodeOptions{})
+	if err != nil {
+		t.Fatalf("NewOrderedMapFromReader: %v", err)
+	}
+	if !reflect.DeepEqual(om, expected) {
+		t.Fatalf("NewOrderedMapFromReader: %#v not deeply equal to expected %#v", om, expected)
+	}
+
+	om, err = NewOrderedMapFromReader(iotest.HalfReader(strings.NewReader(data)), DecodeOptions{MaxValueSize: 5000})
+	if err != nil {
+		t.Fatalf("NewOrderedMapFromReader with MaxValueSize: %v", err)
+	}
+	if !reflect.DeepEqual(om, expected) {
+		t.Fatalf("NewOrderedMapFromReader with MaxValueSize: %#v not deeply equal to expected %#v", om, expected)
+	}
+
+	if _, err := NewOrderedMapFromReader(strings.NewReader(`{"a": 1} {}`), DecodeOptions{}); err == nil {
+		t.Fatal("NewOrderedMapFromReader: expecting error for more content")
+	}
+}
+
+func TestMaxValueSize(t *testing.T) {
+	opts := DecodeOptions{MaxValueSize: 8}
+	om := NewOrderedMap()
+	if err := om.UnmarshalWithOptions([]byte(`{"a": "12345678", "n": 12345678}`), opts); err != nil {
+		t.Fatalf("UnmarshalWithOptions: %v", err)
+	}
+	for _, data := range []string{
+		`{"a": "123456789"}`,
+		`{"a": [1, 123456789]}`,
+	} {
+		err := om.UnmarshalWithOptions([]byte(data), opts)
+		if err == nil || !strings.Contains(err.Error(), "exceeds the MaxValueSize of 8 bytes") {
+			t.Fatalf("UnmarshalWithOptions %s: expect MaxValueSize error but got %v", data, err)
+		}
+	}
+	err := om.UnmarshalWithOptions([]byte(`{"a": {"b": [1, 2, 3]}}`), DecodeOptions{MaxValueSize: 8, MaxDecodeDepth: 1})
+	if err == nil {
+		t.Fatal("UnmarshalWithOptions: expect MaxValueSize error for a large raw value")
+	}
+
+	// a huge streamed value fails without reading it all
+	huge := &longStringReader{n: 1 << 30}
+	r := io.MultiReader(strings.NewReader(`{"a": 1, "huge": "`), huge, strings.NewReader(`"}`))
+	_, err = NewOrderedMapFromReader(r, DecodeOptions{MaxValueSize: 1 << 16})
+	if err == nil || !strings.Contains(err.Error(), "exceeds the MaxValueSize") {
+		t.Fatalf("NewOrderedMapFromReader: expect MaxValueSize error but got %v", err)
+	}
+	if huge.read > 1<<18 {
+		t.Fatalf("NewOrderedMapFromReader: read %d bytes of the huge value, expect to stop early", huge.read)
+	}
+}
+
+func TestUnmarshalRawKeys(t *testing.T) {
+	data := `{"caf\u00e9": 1, "plain": {"A\/b": [2]}, "\u00E9": 3, "é": 4}`
+
+	om := NewOrderedMap()
+	if err := om.UnmarshalWithOptions([]byte(data), DecodeOptions{RawKeys: true}); err != nil {
+		t.Fatalf("UnmarshalWithOptions: %v", err)
+	}
+	b, err := json.Marshal(om)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	// a duplicate key keeps the bytes of its first appearance
+	if expected := `{"caf\u00e9":1,"plain":{"A\/b":[2]},"\u00E9":4}`; string(b) != expected {
+		t.Fatalf("RawKeys: got %s, expected %s", b, expected)
+	}
+	if om.meta["plain"] != nil {
+		t.Fatal("RawKeys: keys quoted the normalized way should not keep their bytes")
+	}
+	if om.Get("café") != json.Number("1") {
+		t.Fatalf("RawKeys: the key should still be decoded, got %v", om.Keys())
+	}
+
+	om = NewOrderedMap()
+	if err := om.UnmarshalJSON([]byte(data)); err != nil {
+		t.Fatalf("UnmarshalJSON: %v", err)
+	}
+	if b, _ = json.Marshal(om); string(b) != `{"café":1,"plain":{"A/b":[2]},"é":4}` {
+		t.Fatalf("UnmarshalJSON: got %s", b)
+	}
+}
+
+func TestUnmarshalAllowNull(t *testing.T) {
+	om := NewOrderedMapFromKVPairs([]*KVPair{{"a", 1}})
+	if err := om.UnmarshalWithOptions([]byte(" null "), DecodeOptions{AllowNull: true}); err != nil {
+		t.Fatalf("UnmarshalWithOptions AllowNull: %v", err)
+	}
+	if !reflect.DeepEqual(om, NewOrderedMap()) {
+		t.Fatalf("UnmarshalWithOptions AllowNull: expect an empty map, got %#v", om)
+	}
+	if err := om.UnmarshalWithOptions([]byte(`null {}`), DecodeOptions{AllowNull: true}); err == nil {
+		t.Fatal("UnmarshalWithOptions AllowNull: expecting error for more content")
+	}
+	if err := om.UnmarshalWithOptions([]byte(`{"a": null}`), DecodeOptions{AllowNull: true}); err != nil || om.Len() != 1 {
+		t.Fatalf("UnmarshalWithOptions AllowNull: %v", err)
+	}
+
+	if err := om.UnmarshalJSON([]byte("null")); err == nil {
+		t.Fatal("UnmarshalJSON: expecting error for null")
+	}
+	if err := om.UnmarshalWithOptions([]byte("null"), DecodeOptions{}); err == nil {
+		t.Fatal("UnmarshalWithOptions: expecting error for null")
+	}
+}
+
+func FuzzOrderedMap(f *testing.F) {
+	for _, seed := range []string{
+		`{}`,
+		`{"a": 1, "b": [true, false, null], "c": {"d": {"e": [[], {}, [{"f": -1.5e-10}]]}}}`,
+		`{"esc": "\"\\\/\b\f\n\r\t\u0000é😀 ", "é\n": "<&>"}`,
+		`{"dup": 1, "dup": {"x": 2}, "dup": [3]}`,
+		`{"n": [0, -0, 1E+2, 12345678901234567890123, 0.1]}`,
+		`{"deep": [[[[[[[[[[{"a": [[[[[[]]]]]]}]]]]]]]]]]}`,
+		`{"bad": "\xff"}`,
+		` {"ws" :	[ 1 ,2 ] } `,
+		`{"a": 1,}`,
+		`[1, 2]`,
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		om := NewOrderedMap()
+		if err := om.UnmarshalJSON(data); err != nil {
+			return
+		}
+		b, err := om.MarshalJSON()
+		if err != nil {
+			t.Fatalf("MarshalJSON of decoded %q: %v", data, err)
+		}
+		round := NewOrderedMap()
+		if err := round.UnmarshalJSON(b); err != nil {
+			t.Fatalf("UnmarshalJSON of re-marshalled %q: %v", b, err)
+		}
+		if !om.Equal(round) {
+			t.Fatalf("round trip of %q: %s decoded differently", data, b)
+		}
+	})
+}
+
+func TestUnmarshalNumberHook(t *testing.T) {
+	hook := func(num json.Number) (interface{}, error) {
+		f, _, err := big.ParseFloat(string(num), 10, 100, big.ToNearestEven)
+		return f, err
+	}
+	data := []byte(`{"a": 0.1, "b": {"c": [1, 12345678901234567890.5, {"d": -2e-3}]}, "s": "1"}`)
+	for _, depth := range []int{0, 3} {
+		om := NewOrderedMap()
+		if err := om.UnmarshalWithOptions(data, DecodeOptions{NumberHook: hook, MaxDecodeDepth: depth}); err != nil {
+			t.Fatalf("UnmarshalWithOptions: %v", err)
+		}
+		if f, ok := om.Get("a").(*big.Float); !ok || f.Text('g', 10) != "0.1" {
+			t.Fatalf("NumberHook: expect *big.Float 0.1, got %T %v", om.Get("a"), om.Get("a"))
+		}
+		if om.Get("s") != "1" {
+			t.Fatalf("NumberHook: strings should not be converted, got %T", om.Get("s"))
+		}
+		b, _ := om.GetOrderedMap("b")
+		arr, _ := b.Get("c").([]interface{})
+		if len(arr) != 3 {
+			t.Fatalf("NumberHook: got %#v", b.Get("c"))
+		}
+		if f, ok := arr[1].(*big.Float); !ok || f.Text('f', 1) != "12345678901234567890.5" {
+			t.Fatalf("NumberHook: nested number not converted precisely, got %T %v", arr[1], arr[1])
+		}
+		if _, ok := arr[0].(*big.Float); !ok {
+			t.Fatalf("NumberHook: nested number not converted, got %T", arr[0])
+		}
+		if d, _ := arr[2].(*OrderedMap); d != nil {
+			if _, ok := d.Get("d").(*big.Float); !ok {
+				t.Fatalf("NumberHook: deep number not converted, got %T", d.Get("d"))
+			}
+		}
+	}
+
+	failing := func(num json.Number) (interface{}, error) {
+		if num == "2" {
+			return nil, fmt.Errorf("unsupported")
+		}
+		return num, nil
+	}
+	err := NewOrderedMap().UnmarshalWithOptions([]byte(`{"a": [1, 2]}`), DecodeOptions{NumberHook: failing})
+	if err == nil || !strings.Contains(err.Error(), "number 2 at offset") || !strings.Contains(err.Error(), "unsupported") {
+		t.Fatalf("NumberHook: expect error with context, got %v", err)
+	}
+}
+
+func TestDecodeArrayStream(t *testing.T) {
+	data := `[{"id": 1, "b": "x"}, {"id": 2, "a": {"z": 1, "y": 2}}, {"id": 3}]`
+	var got []string
+	err := DecodeArrayStream(iotest.OneByteReader(strings.NewReader(data)), func(index int, om *OrderedMap) error {
+		b, err := json.Marshal(om)
+		got = append(got, fmt.Sprintf("%d %s", index, b))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("DecodeArrayStream: %v", err)
+	}
+	expected := []string{`0 {"id":1,"b":"x"}`, `1 {"id":2,"a":{"z":1,"y":2}}`, `2 {"id":3}`}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("DecodeArrayStream: got %v, expected %v", got, expected)
+	}
+
+	stop := fmt.Errorf("stop")
+	calls := 0
+	err = DecodeArrayStream(strings.NewReader(data), func(index int, om *OrderedMap) error {
+		calls++
+		if index == 1 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || calls != 2 {
+		t.Fatalf("DecodeArrayStream: expect the error of fn after 2 calls, got %v after %d", err, calls)
+	}
+
+	for _, data := range []string{
+		`[{"id": 1}, {"id": 2,}, {"id": 3}]`,
+		`[{"id": 1}, 2]`,
+	} {
+		calls = 0
+		err = DecodeArrayStream(strings.NewReader(data), func(int, *OrderedMap) error {
+			calls++
+			return nil
+		})
+		if err == nil || !strings.Contains(err.Error(), "array element 1") || calls != 1 {
+			t.Fatalf("DecodeArrayStream %s: expect error on element 1, got %v after %d calls", data, err, calls)
+		}
+	}
+	for _, data := range []string{`{"id": 1}`, `[{"id": 1}`, `[] []`} {
+		if err = DecodeArrayStream(strings.NewReader(data), func(int, *OrderedMap) error { return nil }); err == nil {
+			t.Fatalf("DecodeArrayStream %s: expecting error", data)
+		}
+	}
+}
+
+func TestDecodeValue(t *testing.T) {
+	v, err := DecodeValue([]byte(`{"b": 1, "a": [{"d": 2, "c": 3}]}`))
+	if err != nil {
+		t.Fatalf("DecodeValue object: %v", err)
+	}
+	om, ok := v.(*OrderedMap)
+	if !ok || !reflect.DeepEqual(om.Keys(), []string{"b", "a"}) {
+		t.Fatalf("DecodeValue object: got %#v", v)
+	}
+
+	v, err = DecodeValue([]byte(` [{"z": 1, "y": 2}, 3, "x", null] `))
+	if err != nil {
+		t.Fatalf("DecodeValue array: %v", err)
+	}
+	arr, ok := v.([]interface{})
+	if !ok || len(arr) != 4 {
+		t.Fatalf("DecodeValue array: got %#v", v)
+	}
+	if elem, ok := arr[0].(*OrderedMap); !ok || !reflect.DeepEqual(elem.Keys(), []string{"z", "y"}) {
+		t.Fatalf("DecodeValue array: expect an ordered map element, got %#v", arr[0])
+	}
+	if !reflect.DeepEqual(arr[1:], []interface{}{json.Number("3"), "x", nil}) {
+		t.Fatalf("DecodeValue array: got %#v", arr[1:])
+	}
+
+	for data, expected := range map[string]interface{}{
+		`"s"`:   "s",
+		`-1.5`:  json.Number("-1.5"),
+		`true`:  true,
+		`null`:  nil,
+		` 42 `:  json.Number("42"),
+		`"a\n"`: "a\n",
+	} {
+		v, err = DecodeValue([]byte(data))
+		if err != nil || v != expected {
+			t.Fatalf("DecodeValue %s: got %#v %v", data, v, err)
+		}
+	}
+
+	for _, data := range []string{``, `{"a": 1`, `[1, 2] 3`, `1 2`, `}`} {
+		if _, err = DecodeValue([]byte(data)); err == nil {
+			t.Fatalf("DecodeValue %q: expecting error", data)
+		}
+	}
+}
+
+func TestDuplicateKeyPolicy(t *testing.T) {
+	defer func(policy DuplicateKeyPolicy) { DuplicateKeys = policy }(DuplicateKeys)
+
+	data := []byte(`{"a": 1, "b": {"c": 1, "c": 2}, "a": 2}`)
+	for _, c := range []struct {
+		policy   DuplicateKeyPolicy
+		expected string
+	}{
+		{KeepLast, `{"a":2,"b":{"c":2}}`},
+		{KeepFirst, `{"a":1,"b":{"c":1}}`},
+		{Combine, `{"a":[1,2],"b":{"c":[1,2]}}`},
+	} {
+		DuplicateKeys = c.policy
+		om := NewOrderedMap()
+		if err := json.Unmarshal(data, om); err != nil {
+			t.Fatalf("Unmarshal with policy %d: %v", c.policy, err)
+		}
+		if b, _ := json.Marshal(om); string(b) != c.expected {
+			t.Fatalf("Unmarshal with policy %d: got %s, expected %s", c.policy, b, c.expected)
+		}
+	}
+
+	DuplicateKeys = Error
+	err := NewOrderedMap().UnmarshalJSON([]byte(`{"a": 1, "a": 2}`))
+	if err == nil || !strings.Contains(err.Error(), `duplicate key "a"`) {
+		t.Fatalf("Unmarshal with policy Error: expect duplicate key error, got %v", err)
+	}
+	// the keys merged into are not duplicates
+	om := NewOrderedMapFromKVPairs([]*KVPair{{"a", 0}})
+	if err := om.UnmarshalMerge([]byte(`{"a": 1}`)); err != nil || om.Get("a") != json.Number("1") {
+		t.Fatalf("UnmarshalMerge with policy Error: %v %v", om.Get("a"), err)
+	}
+	if err := om.UnmarshalWithOptions([]byte(`{"a": 1, "a": 2}`), DecodeOptions{PreserveDuplicates: true}); err != nil {
+		t.Fatalf("UnmarshalWithOptions PreserveDuplicates: %v", err)
+	}
+	if multi, ok := om.Get("a").(MultiValue); !ok || len(multi) != 2 {
+		t.Fatalf("UnmarshalWithOptions PreserveDuplicates: should override the policy, got %#v", om.Get("a"))
+	}
+}
+
+func TestUnmarshalLowercaseKeys(t *testing.T) {
+	om := NewOrderedMap()
+	data := []byte(`{"Name": "x", "ID": 1, "name": "y", "Nested": {"InnerKey": [{"DEEP": true}]}}`)
+	if err := om.UnmarshalWithOptions(data, DecodeOptions{LowercaseKeys: true, RawKeys: true}); err != nil {
+		t.Fatalf("UnmarshalWithOptions: %v", err)
+	}
+	b, _ := json.Marshal(om)
+	if expected := `{"name":"y","id":1,"nested":{"innerkey":[{"deep":true}]}}`; string(b) != expected {
+		t.Fatalf("LowercaseKeys: got %s, expected %s", b, expected)
+	}
+
+	if err := om.UnmarshalJSON(data); err != nil {
+		t.Fatalf("UnmarshalJSON: %v", err)
+	}
+	if !reflect.DeepEqual(om.Keys(), []string{"Name", "ID", "name", "Nested"}) {
+		t.Fatalf("UnmarshalJSON: keys should keep their case, got %v", om.Keys())
+	}
+}
+
+func TestUnmarshalDetectEncoding(t *testing.T) {
+	const expected = `{"b":"é","a":[1,"😀"]}`
+	text := `{"b": "é", "a": [1, "😀"]}`
+	opts := DecodeOptions{DetectEncoding: true}
+
+	utf16le := []byte{0xFF, 0xFE}
+	utf16be := []byte{0xFE, 0xFF}
+	for _, u := range utf16.Encode([]rune(text)) {
+		utf16le = append(utf16le, byte(u), byte(u>>8))
+		utf16be = append(utf16be, byte(u>>8), byte(u))
+	}
+	inputs := map[string][]byte{
+		"no BOM":    []byte(text),
+		"UTF-8 BOM": append([]byte{0xEF, 0xBB, 0xBF}, text...),
+		"UTF-16 LE": utf16le,
+		"UTF-16 BE": utf16be,
+	}
+	for name, data := range inputs {
+		om := NewOrderedMap()
+		if err := om.UnmarshalWithOptions(data, opts); err != nil {
+			t.Fatalf("DetectEncoding %s: %v", name, err)
+		}
+		if b, _ := json.Marshal(om); string(b) != expected {
+			t.Fatalf("DetectEncoding %s: got %s, expected %s", name, b, expected)
+		}
+	}
+
+	om, err := NewOrderedMapFromReader(bytes.NewReader(utf16le), opts)
+	if err != nil {
+		t.Fatalf("NewOrderedMapFromReader DetectEncoding: %v", err)
+	}
+	if b, _ := json.Marshal(om); string(b) != expected {
+		t.Fatalf("NewOrderedMapFromReader DetectEncoding: got %s", b)
+	}
+
+	for _, data := range [][]byte{
+		append([]byte{0xEF, 0xBB, 0xBF}, "{\"a\": \"\xff\"}"...),
+		[]byte("{\"a\": \"\xc3\"}"),
+		append(utf16le, 0),
+	} {
+		if err := NewOrderedMap().UnmarshalWithOptions(data, opts); err == nil {
+			t.Fatalf("DetectEncoding %q: expect an error", data)
+		}
+	}
+	if err := NewOrderedMap().UnmarshalJSON(append([]byte{0xEF, 0xBB, 0xBF}, "{}"...)); err == nil {
+		t.Fatal("UnmarshalJSON: expect an error for a BOM without DetectEncoding")
+	}
+}
+
+func TestDecodeMaxInputSize(t *testing.T) {
+	data := `{"a": "` + strings.Repeat("x", 100) + `", "b": [1, 2, 3]}`
+	expected := fmt.Sprintf("JSON input exceeds the MaxInputSize of %d bytes", len(data)-1)
+
+	for _, comments := range []bool{false, true} {
+		opts := DecodeOptions{MaxInputSize: len(data), Comments: comments}
+		if _, err := NewOrderedMapFromReader(iotest.OneByteReader(strings.NewReader(data)), opts); err != nil {
+			t.Fatalf("MaxInputSize at the limit, Comments %v: %v", comments, err)
+		}
+		if err := NewOrderedMap().UnmarshalWithOptions([]byte(data), opts); err != nil {
+			t.Fatalf("UnmarshalWithOptions MaxInputSize at the limit: %v", err)
+		}
+
+		opts.MaxInputSize--
+		if _, err := NewOrderedMapFromReader(strings.NewReader(data), opts); err == nil || err.Error() != expected {
+			t.Fatalf("MaxInputSize over the limit, Comments %v: got %v, expected %s", comments, err, expected)
+		}
+		if err := NewOrderedMap().UnmarshalWithOptions([]byte(data), opts); err == nil || err.Error() != expected {
+			t.Fatalf("UnmarshalWithOptions MaxInputSize over the limit: got %v, expected %s", err, expected)
+		}
+	}
+
+	// over the limit only by the bytes after the object
+	trailing := `{"a": 1}` + strings.Repeat(" ", 10)
+	expected = "JSON input exceeds the MaxInputSize of 12 bytes"
+	if _, err := NewOrderedMapFromReader(strings.NewReader(trailing), DecodeOptions{MaxInputSize: 12}); err == nil || err.Error() != expected {
+		t.Fatalf("MaxInputSize over the limit by trailing bytes: got %v, expected %s", err, expected)
+	}
+
+	// an endless input stops at the limit
+	endless := io.MultiReader(strings.NewReader(`{"a": "`), iotest.OneByteReader(strings.NewReader(strings.Repeat("x", 1<<20))))
+	if _, err := NewOrderedMapFromReader(endless, DecodeOptions{MaxInputSize: 1024}); err == nil || !strings.Contains(err.Error(), "MaxInputSize of 1024") {
+		t.Fatalf("MaxInputSize of a huge input: got %v", err)
+	}
+}
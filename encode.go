@@ -0,0 +1,637 @@
+package ordered
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// write the JSON encoding of the map to w, same output as MarshalJSON
+func (om *OrderedMap) Encode(w io.Writer) error {
+	b, err := om.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// same as Encode but followed by a '\n', so multiple calls on the same writer
+// produce a NDJSON (newline-delimited JSON) stream, one object per line
+func (om *OrderedMap) EncodeLine(w io.Writer) error {
+	b, err := om.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// write the JSON encoding of the map to w an entry at a time, in order, calling hook with each key just
+// before writing its entry, such as for interleaving custom logic while writing a large object; the keys
+// for which hook returns false are skipped, and a nil hook writes all keys, the same output as Encode
+func (om *OrderedMap) EncodeWithHook(w io.Writer, hook func(key string) bool) error {
+	e := newEncoder(MarshalOptions{})
+	e.useCache = true
+	e.buf = append(e.buf, '{')
+	written := 0
+	for el := om.l.Front(); el != nil; el = el.Next() {
+		k := el.Value.(string)
+		if hook != nil && !hook(k) {
+			continue
+		}
+		if written > 0 {
+			e.buf = append(e.buf, ',')
+		}
+		written++
+		if meta, ok := om.meta[k]; ok && meta.rawKey != nil {
+			e.buf = append(e.buf, meta.rawKey...)
+		} else if err := e.encodeValue(k); err != nil {
+			return err
+		}
+		e.buf = append(e.buf, ':')
+		e.depth = 1
+		if err := e.encodeValue(om.m[k]); err != nil {
+			return err
+		}
+		if _, err := w.Write(e.buf); err != nil {
+			return err
+		}
+		e.buf = e.buf[:0]
+	}
+	_, err := w.Write(append(e.buf, '}'))
+	return err
+}
+
+// the options for MarshalWithOptions, the zero value produces the same output as json.Marshal(om);
+// the options apply to the whole tree of nested OrderedMap and []interface{} values
+type MarshalOptions struct {
+	// written between an object key and its value, default ":", or ": " when indenting;
+	// use ": " for the spaced single-line style
+	KeyValueSep string
+	// written between object members and array elements, default ","; use ", " for the spaced single-line style
+	ItemSep string
+	// when any is set, write each object member and array element on a new line beginning with
+	// Prefix followed by copies of Indent for the nesting level, same as json.MarshalIndent
+	Prefix string
+	Indent string
+	// write the comment of each key (see SetComment) before the key, as "//" line comments on
+	// their own lines when indenting, or else as a "/* */" block comment; the output is then JSON5
+	Comments bool
+	// when set, write float64 values with at most this many significant digits instead of the
+	// shortest representation that round trips; float64 values holding an integer are written in
+	// full without decimals. Either way no exponent is used for magnitudes from 1e-6 to below 1e21,
+	// same as json.Marshal; json.Number values are written unchanged
+	FloatPrecision int
+	// write the keys of every object sorted ascending instead of in the map order, for a deterministic output
+	SortKeys bool
+	// escape every '/' of the strings, keys included, as "\/" for legacy consumers requiring it;
+	// by default '/' is written as is, same as json.Marshal
+	EscapeSlashes bool
+	// the layout for time.Time values, such as "2006-01-02", as of time.Format; by default
+	// they are written in RFC 3339 format with nanoseconds, same as json.Marshal
+	TimeLayout string
+	// when set, the keys of every object are written as the result of it, such as camelCase names
+	// for snake_case keys, leaving the map unchanged; SortKeys still sorts by the keys of the map
+	KeyTransform func(key string) string
+	// write a nested OrderedMap without keys as null instead of {}, at any level; EmptyRootAsNull
+	// does the same for the map marshalled itself
+	EmptyObjectAsNull bool
+	EmptyRootAsNull   bool
+	// write only the members of the keys in IncludeKeys, or all but the ones in ExcludeKeys, in every
+	// object by the key name at any level, leaving the map unchanged; setting both is an error
+	IncludeKeys []string
+	ExcludeKeys []string
+	// write the keys that are identifiers, matching [A-Za-z_$][A-Za-z0-9_$]*, without quotes and
+	// quote the others, for the relaxed readers of JSON5; the output is no longer JSON
+	UnquoteIdentifierKeys bool
+	// write the numbers, json.Number included, as JSON strings such as "12345678901234567890", for the
+	// JavaScript clients losing the precision of big integers
+	NumbersAsStrings bool
+	// when set along with NumbersAsStrings, only the numbers written as integers of an absolute value above
+	// it are written as strings, such as 1<<53 - 1 for the integers JavaScript can't represent exactly, a
+	// float64 of 1e17 written 100000000000000000 included; the other numbers, and any number written with
+	// a fraction or an exponent, are written as numbers
+	NumbersAsStringsAbove int64
+}
+
+// marshal the map like MarshalJSON, but controlled by the options
+func (om *OrderedMap) MarshalWithOptions(opts MarshalOptions) ([]byte, error) {
+	if opts.IncludeKeys != nil && opts.ExcludeKeys != nil {
+		return nil, fmt.Errorf("MarshalOptions IncludeKeys and ExcludeKeys are mutually exclusive")
+	}
+	e := newEncoder(opts)
+	if err := e.encodeMap(om); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+// the indented JSON of the map with the keys of every object sorted, the same for maps of the same
+// content in any order, such as for comparing with golden files; empty if the map cannot be marshalled
+func (om *OrderedMap) SnapshotString() string {
+	b, err := om.MarshalWithOptions(MarshalOptions{Indent: "  ", SortKeys: true})
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// the compact JSON of the map with the keys of every object sorted ascending by their bytes, and the
+// json.Number values written byte for byte as decoded, such as 1.0 or 1e5, never reformatted; a
+// deterministic output for signing or hashing that keeps the numbers of the input
+func (om *OrderedMap) MarshalSortedPreserveNumbers() ([]byte, error) {
+	return om.MarshalWithOptions(MarshalOptions{SortKeys: true})
+}
+
+type encoder struct {
+	opts      MarshalOptions
+	buf       []byte
+	kvSep     string
+	itemSep   string
+	multiline bool
+	depth     int
+
+	include map[string]bool // the keys of IncludeKeys, or of ExcludeKeys mapped to false
+	exclude bool
+
+	useCache bool                 // reuse the bytes cached by EnableMarshalCache, only for MarshalJSON
+	cached   int                  // the number of cached maps being written
+	clean    map[*OrderedMap]bool // the maps known unchanged since cached
+}
+
+func newEncoder(opts MarshalOptions) *encoder {
+	e := &encoder{
+		opts:      opts,
+		kvSep:     opts.KeyValueSep,
+		itemSep:   opts.ItemSep,
+		multiline: opts.Prefix != "" || opts.Indent != "",
+	}
+	if e.kvSep == "" {
+		e.kvSep = ":"
+		if e.multiline {
+			e.kvSep = ": "
+		}
+	}
+	if e.itemSep == "" {
+		e.itemSep = ","
+	}
+	if opts.IncludeKeys != nil || opts.ExcludeKeys != nil {
+		keys := opts.IncludeKeys
+		if opts.ExcludeKeys != nil {
+			keys, e.exclude = opts.ExcludeKeys, true
+		}
+		e.include = make(map[string]bool, len(keys))
+		for _, k := range keys {
+			e.include[k] = true
+		}
+	}
+	return e
+}
+
+// whether the member of the key is written, by IncludeKeys and ExcludeKeys
+func (e *encoder) writesKey(k string) bool {
+	return e.include == nil || e.include[k] != e.exclude
+}
+
+// start a new line for the current nesting level, when indenting
+func (e *encoder) newline() {
+	if !e.multiline {
+		return
+	}
+	e.buf = append(e.buf, '\n')
+	e.buf = append(e.buf, e.opts.Prefix...)
+	for i := 0; i < e.depth; i++ {
+		e.buf = append(e.buf, e.opts.Indent...)
+	}
+}
+
+func (e *encoder) encodeMap(om *OrderedMap) error {
+	if e.useCache && om != nil && (om.cache != nil || e.cached > 0) {
+		return e.encodeCached(om)
+	}
+	return e.writeMap(om)
+}
+
+func (e *encoder) writeMap(om *OrderedMap) error {
+	if om == nil || (om.l.Len() == 0 && ((e.depth == 0 && e.opts.EmptyRootAsNull) || (e.depth > 0 && e.opts.EmptyObjectAsNull))) {
+		e.buf = append(e.buf, "null"...)
+		return nil
+	}
+	var sorted []string
+	if e.opts.SortKeys {
+		sorted = om.Keys()
+		sort.Strings(sorted)
+	}
+	e.buf = append(e.buf, '{')
+	e.depth++
+	el := om.l.Front()
+	written := 0
+	for i := 0; i < om.l.Len(); i++ {
+		var k string
+		if sorted != nil {
+			k = sorted[i]
+		} else {
+			k = el.Value.(string)
+			el = el.Next()
+		}
+		if !e.writesKey(k) {
+			continue
+		}
+		if written > 0 {
+			e.buf = append(e.buf, e.itemSep...)
+		}
+		written++
+		e.newline()
+		if e.opts.Comments {
+			e.writeComment(om.Comment(k))
+		}
+		name := k
+		if e.opts.KeyTransform != nil {
+			name = e.opts.KeyTransform(k)
+		}
+		if e.opts.UnquoteIdentifierKeys && isIdentifier(name) {
+			e.buf = append(e.buf, name...)
+		} else if meta, ok := om.meta[k]; ok && meta.rawKey != nil && e.opts.KeyTransform == nil {
+			e.buf = append(e.buf, meta.rawKey...)
+		} else if err := e.encodeValue(name); err != nil {
+			return err
+		}
+		e.buf = append(e.buf, e.kvSep...)
+		if err := e.encodeValue(om.m[k]); err != nil {
+			return err
+		}
+	}
+	e.depth--
+	if written > 0 {
+		e.newline()
+	}
+	e.buf = append(e.buf, '}')
+	return nil
+}
+
+func (e *encoder) writeComment(comment string) {
+	if comment == "" {
+		return
+	}
+	if !e.multiline {
+		e.buf = append(e.buf, "/* "...)
+		e.buf = append(e.buf, strings.Replace(comment, "*/", "* /", -1)...)
+		e.buf = append(e.buf, " */"...)
+		return
+	}
+	for _, line := range strings.Split(comment, "\n") {
+		e.buf = append(e.buf, "// "...)
+		e.buf = append(e.buf, line...)
+		e.newline()
+	}
+}
+
+func (e *encoder) encodeArray(arr []interface{}) error {
+	if arr == nil {
+		e.buf = append(e.buf, "null"...)
+		return nil
+	}
+	e.buf = append(e.buf, '[')
+	e.depth++
+	for i, v := range arr {
+		if i > 0 {
+			e.buf = append(e.buf, e.itemSep...)
+		}
+		e.newline()
+		if err := e.encodeValue(v); err != nil {
+			return err
+		}
+	}
+	e.depth--
+	if len(arr) > 0 {
+		e.newline()
+	}
+	e.buf = append(e.buf, ']')
+	return nil
+}
+
+func (e *encoder) encodeValue(v interface{}) error {
+	switch v := v.(type) {
+	case *OrderedMap:
+		return e.encodeMap(v)
+	case []interface{}:
+		return e.encodeArray(v)
+	case MultiValue:
+		return e.encodeArray(v)
+	case []*OrderedMap:
+		// such as the groups of GroupBy, written with the same options as the other maps
+		if v == nil {
+			return e.encodeArray(nil)
+		}
+		arr := make([]interface{}, len(v))
+		for i := range v {
+			arr[i] = v[i]
+		}
+		return e.encodeArray(arr)
+	}
+	start := len(e.buf)
+	if f, ok := v.(float64); ok && e.opts.FloatPrecision > 0 && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		e.buf = appendFloat(e.buf, roundFloat(f, e.opts.FloatPrecision))
+	} else if t, ok := e.timeValue(v); ok {
+		e.buf = appendString(e.buf, t.Format(e.opts.TimeLayout))
+	} else if b, ok := appendScalar(e.buf, v); ok {
+		e.buf = b
+	} else if err := e.encodeOther(v); err != nil {
+		return err
+	}
+	if e.opts.NumbersAsStrings {
+		// only what was written as a number, not a type of a number kind with its own MarshalJSON
+		if num := string(e.buf[start:]); isValidNumber(num) && e.numberAsString(v, num) {
+			// a number written has nothing to escape
+			e.buf = append(append(append(e.buf[:start], '"'), num...), '"')
+		}
+	}
+	if e.opts.EscapeSlashes {
+		e.buf = escapeSlashes(e.buf, start)
+	}
+	return nil
+}
+
+// whether the value written as num is a number to write as a string, see MarshalOptions.NumbersAsStrings;
+// the threshold is checked on the text written, so a float64 and an int64 of the same digits are the same
+func (e *encoder) numberAsString(v interface{}, num string) bool {
+	if _, ok := toFloat(v); !ok {
+		return false
+	}
+	above := e.opts.NumbersAsStringsAbove
+	if above == 0 {
+		return true
+	}
+	if strings.ContainsAny(num, ".eE") {
+		return false
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil {
+		// beyond int64, so above any threshold
+		return errors.Is(err, strconv.ErrRange)
+	}
+	return n > above || n < -above
+}
+
+// the time.Time to format with MarshalOptions.TimeLayout, when set
+func (e *encoder) timeValue(v interface{}) (time.Time, bool) {
+	if e.opts.TimeLayout == "" {
+		return time.Time{}, false
+	}
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case *time.Time:
+		if v != nil {
+			return *v, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// escape the '/' of the JSON written from start, a '/' may only appear inside strings
+func escapeSlashes(buf []byte, start int) []byte {
+	n := bytes.Count(buf[start:], []byte{'/'})
+	if n == 0 {
+		return buf
+	}
+	res := make([]byte, start, len(buf)+n)
+	copy(res, buf[:start])
+	for _, c := range buf[start:] {
+		if c == '/' {
+			res = append(res, '\\')
+		}
+		res = append(res, c)
+	}
+	return res
+}
+
+// any other value is delegated to json.Marshal
+func (e *encoder) encodeOther(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if e.multiline {
+		var buf bytes.Buffer
+		if err = json.Indent(&buf, b, e.opts.Prefix+strings.Repeat(e.opts.Indent, e.depth), e.opts.Indent); err != nil {
+			return err
+		}
+		b = buf.Bytes()
+	} else if e.kvSep != ":" || e.itemSep != "," {
+		b = respace(b, e.kvSep, e.itemSep)
+	}
+	e.buf = append(e.buf, b...)
+	return nil
+}
+
+// whether s matches [A-Za-z_$][A-Za-z0-9_$]*
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '_' || c == '$' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || (i > 0 && '0' <= c && c <= '9') {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// the fast path of the most common scalar types, avoiding the reflection of json.Marshal;
+// the output is exactly the same as json.Marshal, not ok means the value should go through json.Marshal
+func appendScalar(dst []byte, v interface{}) ([]byte, bool) {
+	switch v := v.(type) {
+	case nil:
+		return append(dst, "null"...), true
+	case string:
+		if !utf8.ValidString(v) {
+			return dst, false
+		}
+		return appendString(dst, v), true
+	case bool:
+		return strconv.AppendBool(dst, v), true
+	case int:
+		return strconv.AppendInt(dst, int64(v), 10), true
+	case int64:
+		return strconv.AppendInt(dst, v, 10), true
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			// let json.Marshal report the error
+			return dst, false
+		}
+		return appendFloat(dst, v), true
+	case json.Number:
+		if v == "" {
+			return append(dst, '0'), true
+		}
+		if !isValidNumber(string(v)) {
+			return dst, false
+		}
+		return append(dst, v...), true
+	}
+	return dst, false
+}
+
+// same as encoding/json, formatted as the ES6 number to string conversion
+func appendFloat(dst []byte, f float64) []byte {
+	abs := math.Abs(f)
+	fmt := byte('f')
+	if abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		fmt = 'e'
+	}
+	dst = strconv.AppendFloat(dst, f, fmt, -1, 64)
+	if fmt == 'e' {
+		// clean up e-09 to e-9
+		n := len(dst)
+		if n >= 4 && dst[n-4] == 'e' && dst[n-3] == '-' && dst[n-2] == '0' {
+			dst[n-2] = dst[n-1]
+			dst = dst[:n-1]
+		}
+	}
+	return dst
+}
+
+// round f to prec significant digits, an integer is kept as is
+func roundFloat(f float64, prec int) float64 {
+	if f == math.Trunc(f) {
+		return f
+	}
+	r, err := strconv.ParseFloat(strconv.FormatFloat(f, 'e', prec-1, 64), 64)
+	if err != nil {
+		return f
+	}
+	return r
+}
+
+const hex = "0123456789abcdef"
+
+// same as encoding/json, quote a valid UTF-8 string with HTML characters, U+2028 and U+2029 escaped;
+// the replacement of invalid UTF-8 differs between encoding/json versions, so such strings go through json.Marshal
+func appendString(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' && b != '<' && b != '>' && b != '&' {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch b {
+			case '\\', '"':
+				dst = append(dst, '\\', b)
+			case '\b':
+				dst = append(dst, '\\', 'b')
+			case '\f':
+				dst = append(dst, '\\', 'f')
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hex[b>>4], hex[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		c, size := utf8.DecodeRuneInString(s[i:])
+		if c == '\u2028' || c == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hex[c&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
+
+// same as encoding/json, check s is a valid JSON number literal
+func isValidNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	if s[0] == '-' {
+		s = s[1:]
+		if s == "" {
+			return false
+		}
+	}
+	switch {
+	default:
+		return false
+	case s[0] == '0':
+		s = s[1:]
+	case '1' <= s[0] && s[0] <= '9':
+		s = s[1:]
+		for len(s) > 0 && '0' <= s[0] && s[0] <= '9' {
+			s = s[1:]
+		}
+	}
+	// . followed by 1 or more digits
+	if len(s) >= 2 && s[0] == '.' && '0' <= s[1] && s[1] <= '9' {
+		s = s[2:]
+		for len(s) > 0 && '0' <= s[0] && s[0] <= '9' {
+			s = s[1:]
+		}
+	}
+	// e or E followed by an optional - or + and 1 or more digits
+	if len(s) >= 2 && (s[0] == 'e' || s[0] == 'E') {
+		s = s[1:]
+		if s[0] == '+' || s[0] == '-' {
+			s = s[1:]
+			if s == "" {
+				return false
+			}
+		}
+		for len(s) > 0 && '0' <= s[0] && s[0] <= '9' {
+			s = s[1:]
+		}
+	}
+	return s == ""
+}
+
+// replace the separators of compact JSON outside of strings
+func respace(b []byte, kvSep, itemSep string) []byte {
+	res := make([]byte, 0, len(b))
+	inString, escaped := false, false
+	for _, c := range b {
+		switch {
+		case inString:
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == ':':
+			res = append(res, kvSep...)
+			continue
+		case c == ',':
+			res = append(res, itemSep...)
+			continue
+		}
+		res = append(res, c)
+	}
+	return res
+}
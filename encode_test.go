@@ -0,0 +1,630 @@
+package ordered
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncode(t *testing.T) {
+	om := NewOrderedMapFromKVPairs([]*KVPair{
+		{"b", 1},
+		{"a", "x"},
+	})
+	var buf bytes.Buffer
+	if err := om.Encode(&buf); err != nil {
+		t.Fatalf("Encode OrderedMap: %v", err)
+	}
+	const expected = `{"b":1,"a":"x"}`
+	if buf.String() != expected {
+		t.Fatalf("Encode OrderedMap: %q not equal to expected %q", buf.String(), expected)
+	}
+}
+
+func TestEncodeLineNDJSON(t *testing.T) {
+	maps := []*OrderedMap{
+		NewOrderedMapFromKVPairs([]*KVPair{{"z", json.Number("1")}, {"a", json.Number("2")}}),
+		NewOrderedMapFromKVPairs([]*KVPair{{"name", "second"}, {"ok", true}}),
+		NewOrderedMapFromKVPairs([]*KVPair{{"c", nil}, {"b", []interface{}{"x"}}, {"a", NewOrderedMapFromKVPairs([]*KVPair{{"y", "1"}, {"x", "2"}})}}),
+	}
+
+	var buf bytes.Buffer
+	for _, om := range maps {
+		if err := om.EncodeLine(&buf); err != nil {
+			t.Fatalf("EncodeLine OrderedMap: %v", err)
+		}
+	}
+
+	out := buf.String()
+	if !strings.HasSuffix(out, "\n") {
+		t.Fatalf("EncodeLine output should end with a newline: %q", out)
+	}
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != len(maps) {
+		t.Fatalf("expect %d lines but got %d: %q", len(maps), len(lines), out)
+	}
+	for i, line := range lines {
+		om := NewOrderedMap()
+		if err := json.Unmarshal([]byte(line), om); err != nil {
+			t.Fatalf("line %d: Unmarshal OrderedMap: %v", i+1, err)
+		}
+		if !reflect.DeepEqual(om, maps[i]) {
+			t.Fatalf("line %d: %#v not deeply equal to expected %#v", i+1, om, maps[i])
+		}
+	}
+}
+
+func TestMarshalWithOptionsSeparators(t *testing.T) {
+	om := NewOrderedMapFromKVPairs([]*KVPair{
+		{"a", 1},
+		{"b", 2},
+		{"c", []interface{}{"x,y", NewOrderedMapFromKVPairs([]*KVPair{{"d:e", []int{3, 4}}})}},
+	})
+
+	compact, err := om.MarshalWithOptions(MarshalOptions{})
+	if err != nil {
+		t.Fatalf("MarshalWithOptions: %v", err)
+	}
+	expected, err := json.Marshal(om)
+	if err != nil {
+		t.Fatalf("Marshal OrderedMap: %v", err)
+	}
+	if !bytes.Equal(compact, expected) {
+		t.Fatalf("MarshalWithOptions default: %s not equal to compact %s", compact, expected)
+	}
+
+	spaced, err := om.MarshalWithOptions(MarshalOptions{KeyValueSep: ": ", ItemSep: ", "})
+	if err != nil {
+		t.Fatalf("MarshalWithOptions: %v", err)
+	}
+	const expectedSpaced = `{"a": 1, "b": 2, "c": ["x,y", {"d:e": [3, 4]}]}`
+	if string(spaced) != expectedSpaced {
+		t.Fatalf("MarshalWithOptions spaced: %s not equal to expected %s", spaced, expectedSpaced)
+	}
+	if string(bytes.Map(noSpace, spaced)) != string(bytes.Map(noSpace, compact)) {
+		t.Fatalf("MarshalWithOptions spaced %s should only differ from compact %s by spaces", spaced, compact)
+	}
+}
+
+// the reflection path, every key and value through json.Marshal
+func marshalReflect(om *OrderedMap) ([]byte, error) {
+	res := []byte{'{'}
+	for e := om.l.Front(); e != nil; e = e.Next() {
+		if e != om.l.Front() {
+			res = append(res, ',')
+		}
+		k := e.Value.(string)
+		b, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		res = append(append(res, b...), ':')
+		b, err = json.Marshal(om.m[k])
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, b...)
+	}
+	return append(res, '}'), nil
+}
+
+func TestMarshalScalarFastPath(t *testing.T) {
+	values := []interface{}{
+		nil, true, false,
+		"", "plain", `quote " and \ backslash`, "<html> & </html>", "line\nfeed\ttab\rreturn\b\f\x01\x1f\x7f",
+		"\u2028\u2029", "invalid \xff\xfe utf8", "unicode é 中文 \U0001D11E",
+		0, 1, -1, math.MaxInt64, math.MinInt64, int64(42), int64(-42),
+		0.0, math.Copysign(0, -1), 1.5, -123.456, 1e20, 1e21, 1e-6, 1e-7, 5e-324, math.MaxFloat64, 1.0 / 3,
+		json.Number(""), json.Number("0"), json.Number("-1.5e+10"), json.Number("12345678901234567890"),
+	}
+	om := NewOrderedMap()
+	for i, v := range values {
+		om.Set(fmt.Sprintf("k%d", i), v)
+	}
+	om.Set("key <&> \"escaped\" \u2028", "v")
+	om.Set("key \xff", "v")
+
+	b, err := om.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON: %v", err)
+	}
+	expected, err := marshalReflect(om)
+	if err != nil {
+		t.Fatalf("marshalReflect: %v", err)
+	}
+	if !bytes.Equal(b, expected) {
+		t.Fatalf("MarshalJSON fast path:\nhave: %s\nwant: %s", b, expected)
+	}
+	if indirect, err := json.Marshal(om); err != nil || !bytes.Equal(indirect, expected) {
+		t.Fatalf("json.Marshal OrderedMap:\nhave: %s %v\nwant: %s", indirect, err, expected)
+	}
+
+	for _, v := range []interface{}{math.NaN(), math.Inf(1), json.Number("0x12")} {
+		if _, err := NewOrderedMapFromKVPairs([]*KVPair{{"bad", v}}).MarshalJSON(); err == nil {
+			t.Fatalf("MarshalJSON: expecting error for %#v", v)
+		}
+	}
+}
+
+func newScalarMap(n int) *OrderedMap {
+	om := NewOrderedMap()
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("key%d", i)
+		switch i % 5 {
+		case 0:
+			om.Set(key, fmt.Sprintf("value %d", i))
+		case 1:
+			om.Set(key, i)
+		case 2:
+			om.Set(key, float64(i)/7)
+		case 3:
+			om.Set(key, i%2 == 0)
+		case 4:
+			om.Set(key, json.Number(strconv.Itoa(i)))
+		}
+	}
+	return om
+}
+
+func BenchmarkMarshalJSONScalars(b *testing.B) {
+	om := newScalarMap(1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := om.MarshalJSON(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalReflectScalars(b *testing.B) {
+	om := newScalarMap(1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := marshalReflect(om); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestMarshalWithOptionsIndent(t *testing.T) {
+	om := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"b": [1, {"c": {}, "d": []}], "a": {"x": null}, "e": {}}`), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	om.Set("f", map[string]interface{}{"y": []int{1, 2}})
+
+	for _, tt := range []struct{ prefix, indent string }{{"", "  "}, {"> ", "\t"}} {
+		b, err := om.MarshalWithOptions(MarshalOptions{Prefix: tt.prefix, Indent: tt.indent})
+		if err != nil {
+			t.Fatalf("MarshalWithOptions: %v", err)
+		}
+		expected, err := json.MarshalIndent(om, tt.prefix, tt.indent)
+		if err != nil {
+			t.Fatalf("MarshalIndent OrderedMap: %v", err)
+		}
+		if !bytes.Equal(b, expected) {
+			t.Fatalf("MarshalWithOptions indent:\nhave: %s\nwant: %s", b, expected)
+		}
+	}
+}
+
+func TestMarshalWithOptionsFloatPrecision(t *testing.T) {
+	om := NewOrderedMap()
+	om.Set("int", float64(12345678901234))
+	om.Set("million", 1e6)
+	om.Set("pi", math.Pi)
+	om.Set("small", 0.000123456789)
+	om.Set("big", 1234567.891)
+	om.Set("number", json.Number("3.14159265358979e+06"))
+	om.Set("nested", []interface{}{2.0 / 3, NewOrderedMapFromKVPairs([]*KVPair{{"x", 1.0 / 3}})})
+
+	b, err := om.MarshalWithOptions(MarshalOptions{FloatPrecision: 4})
+	if err != nil {
+		t.Fatalf("MarshalWithOptions: %v", err)
+	}
+	expected := `{"int":12345678901234,"million":1000000,"pi":3.142,"small":0.0001235,"big":1235000,` +
+		`"number":3.14159265358979e+06,"nested":[0.6667,{"x":0.3333}]}`
+	if string(b) != expected {
+		t.Fatalf("MarshalWithOptions FloatPrecision: got %s, expected %s", b, expected)
+	}
+
+	// the default is the shortest representation, same as json.Marshal
+	b, err = om.MarshalWithOptions(MarshalOptions{})
+	if err != nil {
+		t.Fatalf("MarshalWithOptions: %v", err)
+	}
+	if s := string(b); !strings.Contains(s, `"pi":3.141592653589793,`) || !strings.Contains(s, `"million":1000000,`) {
+		t.Fatalf("MarshalWithOptions: got %s", b)
+	}
+}
+
+func TestSnapshotString(t *testing.T) {
+	a := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"b": 1, "a": {"y": [{"q": 1, "p": 2}], "x": null}, "c": {"n": 1, "m": 2}}`), a); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	b := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"c": {"m": 2, "n": 1}, "a": {"x": null, "y": [{"p": 2, "q": 1}]}, "b": 1}`), b); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	b.Set("c", map[string]interface{}{"n": 1, "m": 2})
+
+	expected := `{
+  "a": {
+    "x": null,
+    "y": [
+      {
+        "p": 2,
+        "q": 1
+      }
+    ]
+  },
+  "b": 1,
+  "c": {
+    "m": 2,
+    "n": 1
+  }
+}`
+	if s := a.SnapshotString(); s != expected {
+		t.Fatalf("SnapshotString: got %s, expected %s", s, expected)
+	}
+	if s := b.SnapshotString(); s != expected {
+		t.Fatalf("SnapshotString: got %s, expected %s", s, expected)
+	}
+	if !reflect.DeepEqual(a.Keys(), []string{"b", "a", "c"}) {
+		t.Fatalf("SnapshotString: the map should not be reordered, got %v", a.Keys())
+	}
+}
+
+func TestMarshalWithOptionsEscapeSlashes(t *testing.T) {
+	om := NewOrderedMap()
+	om.Set("url", "http://x/y")
+	om.Set("a/b", []interface{}{"/", NewOrderedMapFromKVPairs([]*KVPair{{"c", "d/e"}})})
+	om.Set("other", map[string]interface{}{"f/g": "h/i"})
+	om.Set("n", 1.5)
+
+	b, err := om.MarshalWithOptions(MarshalOptions{EscapeSlashes: true})
+	if err != nil {
+		t.Fatalf("MarshalWithOptions: %v", err)
+	}
+	expected := `{"url":"http:\/\/x\/y","a\/b":["\/",{"c":"d\/e"}],"other":{"f\/g":"h\/i"},"n":1.5}`
+	if string(b) != expected {
+		t.Fatalf("MarshalWithOptions EscapeSlashes: got %s, expected %s", b, expected)
+	}
+
+	b, err = om.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON: %v", err)
+	}
+	if expected := `{"url":"http://x/y","a/b":["/",{"c":"d/e"}],"other":{"f/g":"h/i"},"n":1.5}`; string(b) != expected {
+		t.Fatalf("MarshalJSON: got %s, expected %s", b, expected)
+	}
+	for _, data := range [][]byte{b, []byte(expected)} {
+		round := NewOrderedMap()
+		if err := round.UnmarshalJSON(data); err != nil || round.Get("url") != "http://x/y" {
+			t.Fatalf("UnmarshalJSON %s: %v %v", data, round.Get("url"), err)
+		}
+	}
+}
+
+func TestMarshalWithOptionsTimeLayout(t *testing.T) {
+	ts := time.Date(2024, 3, 9, 15, 4, 5, 0, time.UTC)
+	om := NewOrderedMap()
+	om.Set("date", ts)
+	om.Set("ptr", &ts)
+	om.Set("nested", []interface{}{NewOrderedMapFromKVPairs([]*KVPair{{"at", ts}})})
+	om.Set("nilptr", (*time.Time)(nil))
+	om.Set("s", "2006-01-02")
+	om.Set("n", 1)
+
+	b, err := om.MarshalWithOptions(MarshalOptions{TimeLayout: "2006-01-02"})
+	if err != nil {
+		t.Fatalf("MarshalWithOptions: %v", err)
+	}
+	expected := `{"date":"2024-03-09","ptr":"2024-03-09","nested":[{"at":"2024-03-09"}],"nilptr":null,"s":"2006-01-02","n":1}`
+	if string(b) != expected {
+		t.Fatalf("MarshalWithOptions TimeLayout: got %s, expected %s", b, expected)
+	}
+
+	b, err = om.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON: %v", err)
+	}
+	expected = `{"date":"2024-03-09T15:04:05Z","ptr":"2024-03-09T15:04:05Z","nested":[{"at":"2024-03-09T15:04:05Z"}],"nilptr":null,"s":"2006-01-02","n":1}`
+	if string(b) != expected {
+		t.Fatalf("MarshalJSON: got %s, expected %s", b, expected)
+	}
+}
+
+func TestMarshalWithOptionsKeyTransform(t *testing.T) {
+	om := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"user_name": "x", "home_dir": {"full_path": "/a"}, "list": [{"item_id": 1}]}`), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	toCamel := func(key string) string {
+		parts := strings.Split(key, "_")
+		for i := 1; i < len(parts); i++ {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+		return strings.Join(parts, "")
+	}
+	b, err := om.MarshalWithOptions(MarshalOptions{KeyTransform: toCamel})
+	if err != nil {
+		t.Fatalf("MarshalWithOptions: %v", err)
+	}
+	if expected := `{"userName":"x","homeDir":{"fullPath":"/a"},"list":[{"itemId":1}]}`; string(b) != expected {
+		t.Fatalf("MarshalWithOptions KeyTransform: got %s, expected %s", b, expected)
+	}
+	if !reflect.DeepEqual(om.Keys(), []string{"user_name", "home_dir", "list"}) {
+		t.Fatalf("MarshalWithOptions KeyTransform: the map keys should be unchanged, got %v", om.Keys())
+	}
+	if nested, _ := om.GetOrderedMap("home_dir"); !nested.Has("full_path") {
+		t.Fatal("MarshalWithOptions KeyTransform: the nested map keys should be unchanged")
+	}
+}
+
+func TestMarshalWithOptionsEmptyObjectAsNull(t *testing.T) {
+	om := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"empty": {}, "full": {"a": {}, "b": 1}, "list": [{}, {"c": []}], "only": {"d": {}}}`), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	for _, c := range []struct {
+		opts     MarshalOptions
+		expected string
+	}{
+		{MarshalOptions{}, `{"empty":{},"full":{"a":{},"b":1},"list":[{},{"c":[]}],"only":{"d":{}}}`},
+		{MarshalOptions{EmptyObjectAsNull: true}, `{"empty":null,"full":{"a":null,"b":1},"list":[null,{"c":[]}],"only":{"d":null}}`},
+		{MarshalOptions{EmptyObjectAsNull: true, Indent: " "}, "{\n \"empty\": null,\n \"full\": {\n  \"a\": null,\n  \"b\": 1\n },\n" +
+			" \"list\": [\n  null,\n  {\n   \"c\": []\n  }\n ],\n \"only\": {\n  \"d\": null\n }\n}"},
+	} {
+		b, err := om.MarshalWithOptions(c.opts)
+		if err != nil {
+			t.Fatalf("MarshalWithOptions: %v", err)
+		}
+		if string(b) != c.expected {
+			t.Fatalf("MarshalWithOptions %+v: got %s, expected %s", c.opts, b, c.expected)
+		}
+	}
+
+	empty := NewOrderedMap()
+	for _, c := range []struct {
+		opts     MarshalOptions
+		expected string
+	}{
+		{MarshalOptions{EmptyObjectAsNull: true}, `{}`},
+		{MarshalOptions{EmptyRootAsNull: true}, `null`},
+	} {
+		if b, err := empty.MarshalWithOptions(c.opts); err != nil || string(b) != c.expected {
+			t.Fatalf("MarshalWithOptions top-level %+v: got %s %v, expected %s", c.opts, b, err, c.expected)
+		}
+	}
+	if b, err := om.MarshalWithOptions(MarshalOptions{EmptyRootAsNull: true}); err != nil || !strings.Contains(string(b), `"empty":{}`) {
+		t.Fatalf("MarshalWithOptions EmptyRootAsNull: nested should be unaffected, got %s %v", b, err)
+	}
+}
+
+func TestMarshalBytes(t *testing.T) {
+	data := []byte("hello\x00\xff world")
+	om := NewOrderedMap()
+	om.Set("b", data)
+	om.Set("empty", []byte{})
+	om.Set("nil", []byte(nil))
+	om.Set("in", []interface{}{[]byte("x")})
+
+	expected := `{"b":"aGVsbG8A/yB3b3JsZA==","empty":"","nil":null,"in":["eA=="]}`
+	b, err := om.MarshalJSON()
+	if err != nil || string(b) != expected {
+		t.Fatalf("MarshalJSON: got %s %v, expected %s", b, err, expected)
+	}
+	if b, err = marshalReflect(om); err != nil || string(b) != expected {
+		t.Fatalf("marshalReflect: got %s %v, expected %s", b, err, expected)
+	}
+
+	round := NewOrderedMap()
+	if err := round.UnmarshalJSON([]byte(expected)); err != nil {
+		t.Fatalf("UnmarshalJSON: %v", err)
+	}
+	if got, ok := round.GetBytes("b"); !ok || !bytes.Equal(got, data) {
+		t.Fatalf("GetBytes: %q %v", got, ok)
+	}
+	if got, ok := round.GetBytes("empty"); !ok || len(got) != 0 {
+		t.Fatalf("GetBytes empty: %q %v", got, ok)
+	}
+	if got, ok := om.GetBytes("b"); !ok || !bytes.Equal(got, data) {
+		t.Fatalf("GetBytes of []byte: %q %v", got, ok)
+	}
+	round.Set("bad", "not base64!")
+	for _, key := range []string{"bad", "in", "missing"} {
+		if got, ok := round.GetBytes(key); ok || got != nil {
+			t.Fatalf("GetBytes %s: expect not ok, got %q", key, got)
+		}
+	}
+}
+
+func TestMarshalWithOptionsIncludeExcludeKeys(t *testing.T) {
+	om := NewOrderedMap()
+	data := `{"id": 1, "user": {"id": 2, "name": "x", "password": "p"}, "list": [{"name": "y", "password": "q"}], "password": "r"}`
+	if err := json.Unmarshal([]byte(data), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	before, _ := om.MarshalJSON()
+
+	b, err := om.MarshalWithOptions(MarshalOptions{IncludeKeys: []string{"user", "name", "list"}})
+	if expected := `{"user":{"name":"x"},"list":[{"name":"y"}]}`; err != nil || string(b) != expected {
+		t.Fatalf("MarshalWithOptions IncludeKeys: got %s %v, expected %s", b, err, expected)
+	}
+	b, err = om.MarshalWithOptions(MarshalOptions{ExcludeKeys: []string{"password", "id"}, Indent: " "})
+	if expected := "{\n \"user\": {\n  \"name\": \"x\"\n },\n \"list\": [\n  {\n   \"name\": \"y\"\n  }\n ]\n}"; err != nil || string(b) != expected {
+		t.Fatalf("MarshalWithOptions ExcludeKeys: got %s %v, expected %s", b, err, expected)
+	}
+	b, err = om.MarshalWithOptions(MarshalOptions{IncludeKeys: []string{}, Indent: " "})
+	if err != nil || string(b) != `{}` {
+		t.Fatalf("MarshalWithOptions IncludeKeys none: got %s %v", b, err)
+	}
+
+	if _, err = om.MarshalWithOptions(MarshalOptions{IncludeKeys: []string{"id"}, ExcludeKeys: []string{"name"}}); err == nil {
+		t.Fatal("MarshalWithOptions: expecting error for both IncludeKeys and ExcludeKeys")
+	}
+	if after, _ := om.MarshalJSON(); string(after) != string(before) {
+		t.Fatalf("MarshalWithOptions: the map should be untouched, got %s", after)
+	}
+}
+
+func TestMarshalWithOptionsUnquoteIdentifierKeys(t *testing.T) {
+	om := NewOrderedMap()
+	for _, key := range []string{"name", "_id", "$ref", "a1", "1a", "with space", "dash-key", "é", ""} {
+		om.Set(key, 1)
+	}
+	om.Set("nested", []interface{}{NewOrderedMapFromKVPairs([]*KVPair{{"inner", true}, {"x.y", false}})})
+
+	b, err := om.MarshalWithOptions(MarshalOptions{UnquoteIdentifierKeys: true})
+	if err != nil {
+		t.Fatalf("MarshalWithOptions: %v", err)
+	}
+	expected := `{name:1,_id:1,$ref:1,a1:1,"1a":1,"with space":1,"dash-key":1,"é":1,"":1,nested:[{inner:true,"x.y":false}]}`
+	if string(b) != expected {
+		t.Fatalf("MarshalWithOptions UnquoteIdentifierKeys: got %s, expected %s", b, expected)
+	}
+
+	b, err = om.MarshalWithOptions(MarshalOptions{})
+	if err != nil {
+		t.Fatalf("MarshalWithOptions: %v", err)
+	}
+	expected = `{"name":1,"_id":1,"$ref":1,"a1":1,"1a":1,"with space":1,"dash-key":1,"é":1,"":1,"nested":[{"inner":true,"x.y":false}]}`
+	if string(b) != expected {
+		t.Fatalf("MarshalWithOptions: got %s, expected %s", b, expected)
+	}
+}
+
+// a type of a number kind not marshalled as a number
+type logLevel int
+
+func (l logLevel) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]string{"debug", "info"}[l])
+}
+
+func TestMarshalWithOptionsNumbersAsStrings(t *testing.T) {
+	om := NewOrderedMap()
+	data := `{"id": 12345678901234567890, "big": 9007199254740993, "small": 42, "neg": -9007199254740993, "f": 1.5, "e": 1e30, "s": "7", "list": [1, null, true]}`
+	if err := json.Unmarshal([]byte(data), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	om.Set("int", int64(1)<<60)
+	om.Set("uint", uint8(200))
+	om.Set("float", 0.26)
+	om.Set("bigfloat", 1e17)
+
+	b, err := om.MarshalWithOptions(MarshalOptions{NumbersAsStrings: true})
+	if err != nil {
+		t.Fatalf("MarshalWithOptions: %v", err)
+	}
+	expected := `{"id":"12345678901234567890","big":"9007199254740993","small":"42","neg":"-9007199254740993","f":"1.5","e":"1e30",` +
+		`"s":"7","list":["1",null,true],"int":"1152921504606846976","uint":"200","float":"0.26","bigfloat":"100000000000000000"}`
+	if string(b) != expected {
+		t.Fatalf("NumbersAsStrings: got %s, expected %s", b, expected)
+	}
+
+	b, err = om.MarshalWithOptions(MarshalOptions{NumbersAsStrings: true, NumbersAsStringsAbove: 1<<53 - 1, FloatPrecision: 1})
+	if err != nil {
+		t.Fatalf("MarshalWithOptions: %v", err)
+	}
+	expected = `{"id":"12345678901234567890","big":"9007199254740993","small":42,"neg":"-9007199254740993","f":1.5,"e":1e30,` +
+		`"s":"7","list":[1,null,true],"int":"1152921504606846976","uint":200,"float":0.3,` +
+		`"bigfloat":"100000000000000000"}`
+	if string(b) != expected {
+		t.Fatalf("NumbersAsStringsAbove: got %s, expected %s", b, expected)
+	}
+
+	om = NewOrderedMapFromKVPairs([]*KVPair{{"l", logLevel(1)}, {"n", 2}})
+	for _, opts := range []MarshalOptions{{NumbersAsStrings: true}, {NumbersAsStrings: true, NumbersAsStringsAbove: -1}} {
+		b, err = om.MarshalWithOptions(opts)
+		if err != nil {
+			t.Fatalf("MarshalWithOptions: %v", err)
+		}
+		if expected := `{"l":"info","n":"2"}`; string(b) != expected || !json.Valid(b) {
+			t.Fatalf("NumbersAsStrings with a custom MarshalJSON: got %s, expected %s", b, expected)
+		}
+	}
+}
+
+func TestMarshalSortedPreserveNumbers(t *testing.T) {
+	om := NewOrderedMap()
+	data := `{"z": 1.0, "a": {"y": 1e5, "b": [{"d": -0.50, "c": 1E-7}]}, "m": 12345678901234567890, "B": 0}`
+	if err := json.Unmarshal([]byte(data), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	b, err := om.MarshalSortedPreserveNumbers()
+	if err != nil {
+		t.Fatalf("MarshalSortedPreserveNumbers: %v", err)
+	}
+	const expected = `{"B":0,"a":{"b":[{"c":1E-7,"d":-0.50}],"y":1e5},"m":12345678901234567890,"z":1.0}`
+	if string(b) != expected {
+		t.Fatalf("MarshalSortedPreserveNumbers: got %s, expected %s", b, expected)
+	}
+	if b, _ = json.Marshal(om); !strings.HasPrefix(string(b), `{"z":1.0,`) {
+		t.Fatalf("MarshalSortedPreserveNumbers: the map order should be kept, got %s", b)
+	}
+}
+
+func TestEncodeWithHook(t *testing.T) {
+	om := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"a": 1, "b": {"x": [1, "s"]}, "c": "v"}`), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	tests := []struct {
+		skip     string
+		expected string
+	}{
+		{"a", `{"b":{"x":[1,"s"]},"c":"v"}`},
+		{"b", `{"a":1,"c":"v"}`},
+		{"c", `{"a":1,"b":{"x":[1,"s"]}}`},
+		{"", `{"a":1,"b":{"x":[1,"s"]},"c":"v"}`},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		var seen []string
+		err := om.EncodeWithHook(&buf, func(key string) bool {
+			seen = append(seen, key)
+			return key != test.skip
+		})
+		if err != nil {
+			t.Fatalf("EncodeWithHook skip %q: %v", test.skip, err)
+		}
+		if buf.String() != test.expected || !json.Valid(buf.Bytes()) {
+			t.Fatalf("EncodeWithHook skip %q: got %s, expected %s", test.skip, buf.String(), test.expected)
+		}
+		if !reflect.DeepEqual(seen, []string{"a", "b", "c"}) {
+			t.Fatalf("EncodeWithHook skip %q: hook called with %v", test.skip, seen)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := om.EncodeWithHook(&buf, func(string) bool { return false }); err != nil || buf.String() != "{}" {
+		t.Fatalf("EncodeWithHook skip all: got %s, err %v", buf.String(), err)
+	}
+	buf.Reset()
+	if err := om.EncodeWithHook(&buf, nil); err != nil || buf.String() != tests[3].expected {
+		t.Fatalf("EncodeWithHook nil hook: got %s, err %v", buf.String(), err)
+	}
+
+	// each entry is written before the hook of the next key is called
+	buf.Reset()
+	var written []string
+	if err := om.EncodeWithHook(&buf, func(string) bool {
+		written = append(written, buf.String())
+		return true
+	}); err != nil {
+		t.Fatalf("EncodeWithHook: %v", err)
+	}
+	if expected := []string{"", `{"a":1`, `{"a":1,"b":{"x":[1,"s"]}`}; !reflect.DeepEqual(written, expected) {
+		t.Fatalf("EncodeWithHook streaming: got %q, expected %q", written, expected)
+	}
+}
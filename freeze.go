@@ -0,0 +1,43 @@
+package ordered
+
+// make the map read-only, along with every OrderedMap nested in it, also inside arrays; every method
+// modifying a frozen map panics, such as Set, Delete, MergeWith, Unmarshal*, NormalizeNumbers, and
+// SetArrayElement, same as assigning to a nil map, since it is a programming error. Reads keep working,
+// and Clone returns a copy free to modify. Values other than OrderedMap, such as the elements of an
+// array read by Get, are not protected from changes done directly on them
+func (om *OrderedMap) Freeze() {
+	// already frozen, also stops a map containing itself
+	if om.frozen {
+		return
+	}
+	om.frozen = true
+	for _, v := range om.m {
+		freezeValue(v)
+	}
+}
+
+// whether the map is frozen, see Freeze
+func (om *OrderedMap) Frozen() bool {
+	return om.frozen
+}
+
+func freezeValue(v interface{}) {
+	switch v := v.(type) {
+	case *OrderedMap:
+		if v != nil {
+			v.Freeze()
+		}
+	case []interface{}:
+		for _, elem := range v {
+			freezeValue(elem)
+		}
+	case MultiValue:
+		for _, elem := range v {
+			freezeValue(elem)
+		}
+	case []*OrderedMap:
+		for _, elem := range v {
+			freezeValue(elem)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package ordered
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func expectFrozenPanic(t *testing.T, op string, fn func()) {
+	t.Helper()
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatalf("%s: expecting panic on a frozen OrderedMap", op)
+		}
+		if msg, _ := r.(string); !strings.Contains(msg, "frozen OrderedMap") {
+			t.Fatalf("%s: unexpected panic %v", op, r)
+		}
+	}()
+	fn()
+}
+
+func TestFreeze(t *testing.T) {
+	om := NewOrderedMap()
+	data := `{"name": "x", "db": {"host": "localhost", "ports": [5432]}, "list": [{"a": 1}], "n": 2}`
+	if err := json.Unmarshal([]byte(data), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	om.Freeze()
+	if !om.Frozen() {
+		t.Fatal("Freeze: map should be frozen")
+	}
+
+	// reads keep working
+	if om.Get("name") != "x" || om.Len() != 4 || !om.Has("db") {
+		t.Fatalf("Freeze: reads should work, got %v", om.Keys())
+	}
+	if b, err := json.Marshal(om); err != nil || string(b) != `{"name":"x","db":{"host":"localhost","ports":[5432]},"list":[{"a":1}],"n":2}` {
+		t.Fatalf("Freeze: Marshal %s %v", b, err)
+	}
+	db, ok := om.GetOrderedMap("db")
+	if !ok || db.Get("host") != "localhost" {
+		t.Fatal("Freeze: nested reads should work")
+	}
+	list, _ := om.GetOrderedMapSlice("list")
+
+	expectFrozenPanic(t, "Set", func() { om.Set("name", "y") })
+	expectFrozenPanic(t, "Set new key", func() { om.Set("z", 1) })
+	expectFrozenPanic(t, "Delete", func() { om.Delete("name") })
+	expectFrozenPanic(t, "DeleteMany", func() { om.DeleteMany("name", "n") })
+	expectFrozenPanic(t, "Prepend", func() { om.Prepend("n", 3) })
+	expectFrozenPanic(t, "Replace", func() { _ = om.Replace("n", 3) })
+	expectFrozenPanic(t, "ReorderByPriority", func() { om.ReorderByPriority([]string{"n"}) })
+	expectFrozenPanic(t, "MergeWith", func() { om.MergeWith(NewOrderedMap(), nil) })
+	expectFrozenPanic(t, "NormalizeNumbers", func() { om.NormalizeNumbers() })
+	expectFrozenPanic(t, "UnmarshalJSON", func() { _ = om.UnmarshalJSON([]byte(`{}`)) })
+	expectFrozenPanic(t, "UnmarshalMerge", func() { _ = om.UnmarshalMerge([]byte(`{}`)) })
+	expectFrozenPanic(t, "SetComment", func() { om.SetComment("n", "c") })
+	expectFrozenPanic(t, "nested Set", func() { db.Set("host", "remote") })
+	expectFrozenPanic(t, "nested SetArrayElement", func() { _ = db.SetArrayElement("ports", 0, 1) })
+	expectFrozenPanic(t, "Set in array", func() { list[0].Set("a", 2) })
+
+	if om.Get("name") != "x" || om.Len() != 4 || db.Get("host") != "localhost" || list[0].Get("a") != json.Number("1") {
+		t.Fatal("Freeze: rejected writes should not change the map")
+	}
+
+	clone := om.Clone()
+	clone.Set("name", "y")
+	if sub, _ := clone.GetOrderedMap("db"); sub.Frozen() {
+		t.Fatal("Clone: copy of a frozen map should not be frozen")
+	}
+}
+
+func TestFreezeRawMessage(t *testing.T) {
+	om := NewOrderedMap()
+	if err := om.UnmarshalWithOptions([]byte(`{"raw": {"a": 1}}`), DecodeOptions{MaxDecodeDepth: 1}); err != nil {
+		t.Fatalf("UnmarshalWithOptions: %v", err)
+	}
+	om.Freeze()
+	raw, ok := om.GetOrderedMap("raw")
+	if !ok || raw.Get("a") != json.Number("1") || !raw.Frozen() {
+		t.Fatalf("GetOrderedMap on frozen: %#v %v", raw, ok)
+	}
+	if _, ok := om.Get("raw").(json.RawMessage); !ok {
+		t.Fatal("GetOrderedMap on frozen: the raw value should not be replaced")
+	}
+}
+
+func TestFreezeCycle(t *testing.T) {
+	a, b := NewOrderedMap(), NewOrderedMap()
+	a.Set("b", b)
+	b.Set("a", []interface{}{a})
+	a.Freeze()
+	if !a.Frozen() || !b.Frozen() {
+		t.Fatal("Freeze: maps of a cycle should be frozen")
+	}
+	expectFrozenPanic(t, "Set in cycle", func() { b.Set("c", 1) })
+}
@@ -0,0 +1,106 @@
+package ordered
+
+// the kinds of HistoryEvent
+const (
+	HistoryInsert = "insert" // Set of a new key
+	HistoryUpdate = "update" // Set of an existing key
+	HistoryDelete = "delete" // Delete of an existing key
+)
+
+// a mutation of the map recorded after EnableHistory
+type HistoryEvent struct {
+	Op       string // HistoryInsert, HistoryUpdate or HistoryDelete
+	Key      string
+	OldValue interface{} // nil for HistoryInsert
+	NewValue interface{} // nil for HistoryDelete
+	Index    int         // the position the key had for HistoryDelete, 0 otherwise
+}
+
+type historyLog struct {
+	events []HistoryEvent
+}
+
+func (h *historyLog) record(event HistoryEvent) {
+	h.events = append(h.events, event)
+}
+
+func (h *historyLog) recordSet(key string, old, value interface{}, existed bool) {
+	if existed {
+		h.record(HistoryEvent{Op: HistoryUpdate, Key: key, OldValue: old, NewValue: value})
+	} else {
+		h.record(HistoryEvent{Op: HistoryInsert, Key: key, NewValue: value})
+	}
+}
+
+// start recording every Set and Delete of the map as a HistoryEvent, including the ones done by
+// Replace, DeleteMany and MergeWith, for auditing, replaying or undoing the changes; other changes, such as
+// Prepend, Update or Unmarshal*, and the changes of nested maps are not recorded. While recording,
+// Delete takes O(n) to find the position of the key. No-op if already recording
+func (om *OrderedMap) EnableHistory() {
+	if om.history == nil {
+		om.history = &historyLog{}
+	}
+}
+
+// return the mutations recorded since EnableHistory, the oldest first; nil if not recording
+func (om *OrderedMap) History() []HistoryEvent {
+	if om.history == nil {
+		return nil
+	}
+	return append([]HistoryEvent{}, om.history.events...)
+}
+
+// reverse the latest mutation recorded and drop it from the history: an inserted key is deleted, an updated
+// key takes its old value back, and a deleted key is inserted back at its position; false if nothing to undo.
+// The changes not recorded since (see EnableHistory) may leave the map different from before the mutation
+func (om *OrderedMap) Undo() bool {
+	om.modify("Undo")
+	if om.history == nil || len(om.history.events) == 0 {
+		return false
+	}
+	n := len(om.history.events) - 1
+	event := om.history.events[n]
+	om.history.events = om.history.events[:n]
+
+	switch event.Op {
+	case HistoryInsert:
+		if e, ok := om.keys[event.Key]; ok {
+			om.l.Remove(e)
+			delete(om.keys, event.Key)
+			delete(om.m, event.Key)
+			delete(om.meta, event.Key)
+		}
+	case HistoryUpdate:
+		if _, ok := om.m[event.Key]; ok {
+			om.m[event.Key] = event.OldValue
+		}
+	case HistoryDelete:
+		if _, ok := om.m[event.Key]; !ok {
+			om.insertAt(event.Index, event.Key)
+		}
+		om.m[event.Key] = event.OldValue
+	}
+	return true
+}
+
+// the position of an existing key, O(n)
+func (om *OrderedMap) indexOf(key string) int {
+	i := 0
+	for e := om.l.Front(); e != nil && e.Value.(string) != key; e = e.Next() {
+		i++
+	}
+	return i
+}
+
+// add a new key at the position, or at the back if the position is beyond the end
+func (om *OrderedMap) insertAt(index int, key string) {
+	e := om.l.Front()
+	for i := 0; i < index && e != nil; i++ {
+		e = e.Next()
+	}
+	if e == nil {
+		om.keys[key] = om.l.PushBack(key)
+	} else {
+		om.keys[key] = om.l.InsertBefore(key, e)
+	}
+}
@@ -0,0 +1,95 @@
+package ordered
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	om := NewOrderedMapFromKVPairs([]*KVPair{{"a", 1}})
+	if om.History() != nil {
+		t.Fatal("History: expect nil before EnableHistory")
+	}
+	om.EnableHistory()
+	if h := om.History(); h == nil || len(h) != 0 {
+		t.Fatalf("History: expect empty history, got %v", h)
+	}
+
+	om.Set("b", 2)
+	om.Set("a", "one")
+	om.Delete("b")
+	om.Delete("missing")
+	_ = om.Replace("a", "uno")
+	om.DeleteMany("a")
+	om.MergeWith(NewOrderedMapFromKVPairs([]*KVPair{{"c", 3}}), nil)
+	om.EnableHistory()
+
+	expected := []HistoryEvent{
+		{Op: HistoryInsert, Key: "b", NewValue: 2},
+		{Op: HistoryUpdate, Key: "a", OldValue: 1, NewValue: "one"},
+		{Op: HistoryDelete, Key: "b", OldValue: 2, Index: 1},
+		{Op: HistoryUpdate, Key: "a", OldValue: "one", NewValue: "uno"},
+		{Op: HistoryDelete, Key: "a", OldValue: "uno", Index: 0},
+		{Op: HistoryInsert, Key: "c", NewValue: 3},
+	}
+	h := om.History()
+	if !reflect.DeepEqual(h, expected) {
+		t.Fatalf("History: %#v not deeply equal to expected %#v", h, expected)
+	}
+	h[0].Key = "changed"
+	if om.History()[0].Key != "b" {
+		t.Fatal("History: the returned events should be a copy")
+	}
+	if om.Clone().History() != nil {
+		t.Fatal("Clone: the history should not be copied")
+	}
+
+	// see TestUnmarshalBSONHistory with the mongo build tag
+	before := len(om.History())
+	if err := om.UnmarshalMerge([]byte(`{"c": 4, "d": 5}`)); err != nil {
+		t.Fatalf("UnmarshalMerge: %v", err)
+	}
+	if err := om.UnmarshalJSON([]byte(`{"e": 6}`)); err != nil {
+		t.Fatalf("UnmarshalJSON: %v", err)
+	}
+	if h := om.History(); len(h) != before {
+		t.Fatalf("History: Unmarshal* should not be recorded, got %v", h[before:])
+	}
+}
+
+func TestUndo(t *testing.T) {
+	om := NewOrderedMapFromKVPairs([]*KVPair{{"a", 1}, {"b", 2}, {"c", 3}})
+	if om.Undo() {
+		t.Fatal("Undo: expect false before EnableHistory")
+	}
+	om.EnableHistory()
+	if om.Undo() {
+		t.Fatal("Undo: expect false for an empty history")
+	}
+
+	states := []*OrderedMap{om.Clone()}
+	om.Set("d", 4)
+	states = append(states, om.Clone())
+	om.Set("b", "two")
+	states = append(states, om.Clone())
+	om.Delete("b")
+	states = append(states, om.Clone())
+	om.Delete("a")
+	states = append(states, om.Clone())
+	om.Delete("d")
+
+	for i := len(states) - 1; i >= 0; i-- {
+		if !om.Undo() {
+			t.Fatalf("Undo: expect true with %d events left", i+1)
+		}
+		if !reflect.DeepEqual(om.Keys(), states[i].Keys()) || !reflect.DeepEqual(om.m, states[i].m) {
+			t.Fatalf("Undo %d: got %v %v, expected %v %v", i, om.Keys(), om.m, states[i].Keys(), states[i].m)
+		}
+	}
+	if om.Undo() || len(om.History()) != 0 {
+		t.Fatal("Undo: expect false after undoing everything")
+	}
+	if expected := NewOrderedMapFromKVPairs([]*KVPair{{"a", 1}, {"b", 2}, {"c", 3}}); !om.Equal(expected) {
+		t.Fatalf("Undo: expect the original map, got %v", om.Keys())
+	}
+}
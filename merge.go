@@ -0,0 +1,261 @@
+package ordered
+
+import "fmt"
+
+// merge the key-value pairs of other into the map; for a key present in both, resolve is called
+// with the existing and incoming values and its return value is stored, keeping the key position;
+// keys only in other are appended in the order of other. A nil resolve lets the incoming value win.
+func (om *OrderedMap) MergeWith(other *OrderedMap, resolve func(key string, existing, incoming interface{}) interface{}) {
+	om.modify("MergeWith")
+	if other == nil {
+		return
+	}
+	for e := other.l.Front(); e != nil; e = e.Next() {
+		key := e.Value.(string)
+		value := other.m[key]
+		if existing, ok := om.m[key]; ok && resolve != nil {
+			value = resolve(key, existing, value)
+		}
+		om.Set(key, value)
+	}
+}
+
+// same as MergeWith with a nil resolve, but only for the entries of other for which keep returns true;
+// the others are skipped, so a key only in other is not added and an existing one keeps its value.
+// A nil keep keeps all the entries
+func (om *OrderedMap) MergeMatching(other *OrderedMap, keep func(key string, value interface{}) bool) {
+	om.modify("MergeMatching")
+	if other == nil {
+		return
+	}
+	for e := other.l.Front(); e != nil; e = e.Next() {
+		key := e.Value.(string)
+		if value := other.m[key]; keep == nil || keep(key, value) {
+			om.Set(key, value)
+		}
+	}
+}
+
+// set every key of defaults the map lacks, appended after the existing keys in the order of defaults,
+// such as for config defaulting; an existing key is left untouched, unless both values are objects, then
+// the defaults apply recursively to the nested object. The values set are cloned, so defaults can be reused
+func (om *OrderedMap) ApplyDefaults(defaults *OrderedMap) {
+	om.modify("ApplyDefaults")
+	if defaults == nil {
+		return
+	}
+	for e := defaults.l.Front(); e != nil; e = e.Next() {
+		key := e.Value.(string)
+		value := defaults.m[key]
+		existing, ok := om.m[key]
+		if !ok {
+			om.Set(key, cloneValue(value))
+			continue
+		}
+		nested, ok := existing.(*OrderedMap)
+		if d, dok := value.(*OrderedMap); ok && dok && nested != nil {
+			nested.ApplyDefaults(d)
+		}
+	}
+}
+
+// merge the maps in turn into a new map, such as for layered configs: a later value wins for a key in
+// several maps, at the position of its first appearance, other keys are appended in order. A shallow
+// merge, the values are not copied and a nested object replaces an earlier one, see MergeAllDeep
+func MergeAll(maps ...*OrderedMap) *OrderedMap {
+	res := NewOrderedMap()
+	for _, om := range maps {
+		res.MergeWith(om, nil)
+	}
+	return res
+}
+
+// same as MergeAll, but the nested objects of a key in several maps are merged recursively the same way;
+// the values are copied, so the result shares nothing with the maps. An array replaces an earlier one
+// as a whole, see MergeOptions.ArrayMergeByIndex
+func MergeAllDeep(maps ...*OrderedMap) *OrderedMap {
+	return MergeAllDeepWithOptions(MergeOptions{}, maps...)
+}
+
+// the options for MergeAllDeepWithOptions, the zero value merges the same as MergeAllDeep
+type MergeOptions struct {
+	// merge the arrays of a key in several maps element by element instead of replacing the earlier one:
+	// the elements at the same index that are both objects are merged recursively, other elements are
+	// replaced, and the longer array keeps its extra elements
+	ArrayMergeByIndex bool
+}
+
+// same as MergeAllDeep, but controlled by the options
+func MergeAllDeepWithOptions(opts MergeOptions, maps ...*OrderedMap) *OrderedMap {
+	res := NewOrderedMap()
+	for _, om := range maps {
+		res.mergeDeep(om, opts)
+	}
+	return res
+}
+
+// merge other into the map, which owns its nested objects
+func (om *OrderedMap) mergeDeep(other *OrderedMap, opts MergeOptions) {
+	if other == nil {
+		return
+	}
+	for e := other.l.Front(); e != nil; e = e.Next() {
+		key := e.Value.(string)
+		om.Set(key, mergeDeepValue(om.m[key], other.m[key], opts))
+	}
+}
+
+// the value of existing, owned by the map merged into, merged with incoming
+func mergeDeepValue(existing, incoming interface{}, opts MergeOptions) interface{} {
+	switch incoming := incoming.(type) {
+	case *OrderedMap:
+		if existing, ok := existing.(*OrderedMap); ok && existing != nil && incoming != nil {
+			existing.mergeDeep(incoming, opts)
+			return existing
+		}
+	case []interface{}:
+		if existing, ok := existing.([]interface{}); ok && opts.ArrayMergeByIndex {
+			for i, elem := range incoming {
+				if i >= len(existing) {
+					existing = append(existing, cloneValue(elem))
+					continue
+				}
+				if _, ok := elem.(*OrderedMap); ok {
+					existing[i] = mergeDeepValue(existing[i], elem, opts)
+				} else {
+					existing[i] = cloneValue(elem)
+				}
+			}
+			return existing
+		}
+	}
+	return cloneValue(incoming)
+}
+
+// apply a JSON Merge Patch (RFC 7386) to the map: a null value deletes the key, an object value is merged
+// recursively into an existing object, or else replaces the value with the object without its null members;
+// any other value replaces the value. An existing key keeps its position, new keys are appended
+func (om *OrderedMap) ApplyMergePatch(patch *OrderedMap) {
+	om.modify("ApplyMergePatch")
+	if patch == nil {
+		return
+	}
+	for e := patch.l.Front(); e != nil; e = e.Next() {
+		key := e.Value.(string)
+		switch value := patch.m[key].(type) {
+		case nil:
+			om.Delete(key)
+		case *OrderedMap:
+			if value == nil {
+				om.Delete(key)
+				continue
+			}
+			target, ok := om.m[key].(*OrderedMap)
+			if !ok || target == nil {
+				target = NewOrderedMap()
+			}
+			target.ApplyMergePatch(value)
+			om.Set(key, target)
+		default:
+			om.Set(key, cloneValue(value))
+		}
+	}
+}
+
+// create the JSON Merge Patch (RFC 7386) turning from into to: the keys added or changed with their new
+// value, the keys removed with null, nested objects diffed recursively, and the unchanged keys omitted;
+// values are compared as Equal. An error is returned for a key of to added or changed to null, which a
+// merge patch can't express; a null unchanged from from is fine
+func CreateMergePatch(from, to *OrderedMap) (*OrderedMap, error) {
+	if from == nil || to == nil {
+		return nil, fmt.Errorf("CreateMergePatch of a nil OrderedMap")
+	}
+	patch := NewOrderedMap()
+	for e := to.l.Front(); e != nil; e = e.Next() {
+		key := e.Value.(string)
+		value := to.m[key]
+		existing, ok := from.m[key]
+		if ok && equalValues(existing, value) {
+			continue
+		}
+		if isNull(value) {
+			return nil, fmt.Errorf("key %q is null, which a merge patch can't set", key)
+		}
+		next, isMap := value.(*OrderedMap)
+		prev, wasMap := existing.(*OrderedMap)
+		if !isMap || !wasMap || prev == nil {
+			prev = NewOrderedMap()
+		}
+		if isMap {
+			sub, err := CreateMergePatch(prev, next)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %v", key, err)
+			}
+			if sub.Len() == 0 && ok && wasMap {
+				// only the keys order differs
+				continue
+			}
+			patch.Set(key, sub)
+			continue
+		}
+		patch.Set(key, cloneValue(value))
+	}
+	for e := from.l.Front(); e != nil; e = e.Next() {
+		if key := e.Value.(string); !to.Has(key) {
+			patch.Set(key, nil)
+		}
+	}
+	return patch, nil
+}
+
+func isNull(v interface{}) bool {
+	om, ok := v.(*OrderedMap)
+	return v == nil || (ok && om == nil)
+}
+
+// diff two arrays of objects matched by the value of their idKey (formatted by fmt.Sprint unless a
+// string, same as BuildIndex), such as the records of a merge patch keyed by id: added are the elements
+// of to with a new id and removed the elements of from whose id is gone, each in its array order, and
+// changed are the elements of to not Equal to the element of the same id in from, in the order of to.
+// The elements are returned as is, not copied. An error is returned for an element missing idKey, or
+// two elements of the same array sharing an id
+func CreateKeyedArrayPatch(from, to []*OrderedMap, idKey string) (added, removed, changed []*OrderedMap, err error) {
+	fromIndex, err := indexByID(from, idKey, "from")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	toIndex, err := indexByID(to, idKey, "to")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	added, removed, changed = make([]*OrderedMap, 0), make([]*OrderedMap, 0), make([]*OrderedMap, 0)
+	for _, elem := range to {
+		prev, ok := fromIndex[toString(elem.m[idKey])]
+		if !ok {
+			added = append(added, elem)
+		} else if !prev.Equal(elem) {
+			changed = append(changed, elem)
+		}
+	}
+	for _, elem := range from {
+		if _, ok := toIndex[toString(elem.m[idKey])]; !ok {
+			removed = append(removed, elem)
+		}
+	}
+	return added, removed, changed, nil
+}
+
+func indexByID(elems []*OrderedMap, idKey, name string) (map[string]*OrderedMap, error) {
+	index := make(map[string]*OrderedMap, len(elems))
+	for i, elem := range elems {
+		if elem == nil || !elem.Has(idKey) {
+			return nil, fmt.Errorf("element %d of %s has no key %q", i, name, idKey)
+		}
+		id := toString(elem.m[idKey])
+		if _, ok := index[id]; ok {
+			return nil, fmt.Errorf("element %d of %s has the duplicate %s %q", i, name, idKey, id)
+		}
+		index[id] = elem
+	}
+	return index, nil
+}
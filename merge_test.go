@@ -0,0 +1,284 @@
+package ordered
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMergeWith(t *testing.T) {
+	newBase := func() *OrderedMap {
+		return NewOrderedMapFromKVPairs([]*KVPair{{"a", 1}, {"b", 2}, {"name", "base"}})
+	}
+	overlay := NewOrderedMapFromKVPairs([]*KVPair{{"d", 4}, {"b", 20}, {"name", "overlay"}, {"c", 3}})
+
+	keepExisting := func(key string, existing, incoming interface{}) interface{} {
+		return existing
+	}
+	om := newBase()
+	om.MergeWith(overlay, keepExisting)
+	expected := NewOrderedMapFromKVPairs([]*KVPair{{"a", 1}, {"b", 2}, {"name", "base"}, {"d", 4}, {"c", 3}})
+	if !reflect.DeepEqual(om, expected) {
+		t.Fatalf("MergeWith keep existing: %#v not deeply equal to expected %#v", om, expected)
+	}
+
+	sum := func(key string, existing, incoming interface{}) interface{} {
+		a, aok := existing.(int)
+		b, bok := incoming.(int)
+		if aok && bok {
+			return a + b
+		}
+		return incoming
+	}
+	om = newBase()
+	om.MergeWith(overlay, sum)
+	expected = NewOrderedMapFromKVPairs([]*KVPair{{"a", 1}, {"b", 22}, {"name", "overlay"}, {"d", 4}, {"c", 3}})
+	if !reflect.DeepEqual(om, expected) {
+		t.Fatalf("MergeWith sum: %#v not deeply equal to expected %#v", om, expected)
+	}
+
+	b, err := json.Marshal(om)
+	if err != nil {
+		t.Fatalf("Marshal OrderedMap: %v", err)
+	}
+	const expectedJSON = `{"a":1,"b":22,"name":"overlay","d":4,"c":3}`
+	if string(b) != expectedJSON {
+		t.Fatalf("MergeWith: %s not equal to expected %s", b, expectedJSON)
+	}
+}
+
+func TestMergeMatching(t *testing.T) {
+	om := NewOrderedMapFromKVPairs([]*KVPair{{"a", 1}, {"b", 2}, {"name", "base"}})
+	overlay := NewOrderedMapFromKVPairs([]*KVPair{{"d", 4}, {"b", "two"}, {"name", 5}, {"c", "three"}})
+
+	om.MergeMatching(overlay, func(key string, value interface{}) bool {
+		_, ok := value.(string)
+		return ok
+	})
+	expected := NewOrderedMapFromKVPairs([]*KVPair{{"a", 1}, {"b", "two"}, {"name", "base"}, {"c", "three"}})
+	if !reflect.DeepEqual(om, expected) {
+		t.Fatalf("MergeMatching string values: %#v not deeply equal to expected %#v", om, expected)
+	}
+	if om.Has("d") {
+		t.Fatal("MergeMatching: the keys not matching should not be added")
+	}
+
+	om.MergeMatching(nil, nil)
+	if !reflect.DeepEqual(om, expected) {
+		t.Fatalf("MergeMatching nil: %#v", om)
+	}
+	om.MergeMatching(overlay, nil)
+	expected = NewOrderedMapFromKVPairs([]*KVPair{{"a", 1}, {"b", "two"}, {"name", 5}, {"c", "three"}, {"d", 4}})
+	if !reflect.DeepEqual(om, expected) {
+		t.Fatalf("MergeMatching nil keep: %#v not deeply equal to expected %#v", om, expected)
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	om := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"port": 8080, "db": {"host": "db1"}, "tags": "x"}`), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	defaults := NewOrderedMap()
+	data := `{"host": "localhost", "port": 80, "db": {"port": 5432, "host": "localhost"}, "tags": {"a": 1}, "log": {"level": "info"}}`
+	if err := json.Unmarshal([]byte(data), defaults); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+
+	om.ApplyDefaults(defaults)
+	b, _ := json.Marshal(om)
+	expected := `{"port":8080,"db":{"host":"db1","port":5432},"tags":"x","host":"localhost","log":{"level":"info"}}`
+	if string(b) != expected {
+		t.Fatalf("ApplyDefaults: got %s, expected %s", b, expected)
+	}
+
+	om.Get("log").(*OrderedMap).Set("level", "debug")
+	if level := defaults.Get("log").(*OrderedMap).Get("level"); level != "info" {
+		t.Fatalf("ApplyDefaults: the defaults should not be shared, got %v", level)
+	}
+}
+
+func TestMergeAllDeepArrayMergeByIndex(t *testing.T) {
+	newMap := func(data string) *OrderedMap {
+		om := NewOrderedMap()
+		if err := json.Unmarshal([]byte(data), om); err != nil {
+			t.Fatalf("Unmarshal OrderedMap: %v", err)
+		}
+		return om
+	}
+	base := newMap(`{"servers": [{"host": "a", "port": 80}, {"host": "b"}, {"host": "c"}], "tags": ["x", "y"]}`)
+	overlay := newMap(`{"servers": [{"port": 8080}, "replaced"], "tags": ["z", "y", {"k": 1}]}`)
+
+	b, _ := json.Marshal(MergeAllDeep(base, overlay))
+	if expected := `{"servers":[{"port":8080},"replaced"],"tags":["z","y",{"k":1}]}`; string(b) != expected {
+		t.Fatalf("MergeAllDeep arrays: got %s, expected %s", b, expected)
+	}
+
+	merged := MergeAllDeepWithOptions(MergeOptions{ArrayMergeByIndex: true}, base, overlay)
+	b, _ = json.Marshal(merged)
+	expected := `{"servers":[{"host":"a","port":8080},"replaced",{"host":"c"}],"tags":["z","y",{"k":1}]}`
+	if string(b) != expected {
+		t.Fatalf("ArrayMergeByIndex: got %s, expected %s", b, expected)
+	}
+
+	merged.Get("servers").([]interface{})[2].(*OrderedMap).Set("host", "changed")
+	merged.Get("tags").([]interface{})[2].(*OrderedMap).Set("k", 2)
+	if b, _ = json.Marshal(base); string(b) != `{"servers":[{"host":"a","port":80},{"host":"b"},{"host":"c"}],"tags":["x","y"]}` {
+		t.Fatalf("ArrayMergeByIndex: the inputs should be untouched, got %s", b)
+	}
+	if b, _ = json.Marshal(overlay); string(b) != `{"servers":[{"port":8080},"replaced"],"tags":["z","y",{"k":1}]}` {
+		t.Fatalf("ArrayMergeByIndex: the inputs should be untouched, got %s", b)
+	}
+}
+
+func TestCreateMergePatch(t *testing.T) {
+	newMap := func(data string) *OrderedMap {
+		om := NewOrderedMap()
+		if err := json.Unmarshal([]byte(data), om); err != nil {
+			t.Fatalf("Unmarshal OrderedMap: %v", err)
+		}
+		return om
+	}
+	from := newMap(`{"title": "x", "author": {"name": "a", "email": "e"}, "tags": ["t1"], "gone": 1, "same": {"k": 1}, "was": 2}`)
+	to := newMap(`{"title": "y", "author": {"name": "a"}, "tags": ["t1", "t2"], "same": {"k": 1}, "was": {"now": "obj"}, "added": {"z": [1]}}`)
+
+	patch, err := CreateMergePatch(from, to)
+	if err != nil {
+		t.Fatalf("CreateMergePatch: %v", err)
+	}
+	b, _ := json.Marshal(patch)
+	if expected := `{"title":"y","author":{"email":null},"tags":["t1","t2"],"was":{"now":"obj"},"added":{"z":[1]},"gone":null}`; string(b) != expected {
+		t.Fatalf("CreateMergePatch: got %s, expected %s", b, expected)
+	}
+
+	from.ApplyMergePatch(patch)
+	if !from.Equal(to) {
+		b, _ = json.Marshal(from)
+		t.Fatalf("ApplyMergePatch: got %s, expected to reconstruct the target", b)
+	}
+
+	if patch, err = CreateMergePatch(to, to.Clone()); err != nil || patch.Len() != 0 {
+		t.Fatalf("CreateMergePatch unchanged: %v %v", patch, err)
+	}
+	if _, err = CreateMergePatch(from, newMap(`{"a": {"b": null}}`)); err == nil {
+		t.Fatal("CreateMergePatch: expecting error for a null in to")
+	}
+	if _, err = CreateMergePatch(newMap(`{"a": 1}`), newMap(`{"a": null}`)); err == nil {
+		t.Fatal("CreateMergePatch: expecting error for a value changed to null")
+	}
+	if _, err = CreateMergePatch(nil, to); err == nil {
+		t.Fatal("CreateMergePatch: expecting error for nil")
+	}
+
+	// a null unchanged needs no patch
+	from = newMap(`{"a": null, "b": 1, "o": {"n": null, "x": 1}}`)
+	to = newMap(`{"a": null, "b": 2, "o": {"n": null, "x": 2}}`)
+	if patch, err = CreateMergePatch(from, to); err != nil {
+		t.Fatalf("CreateMergePatch unchanged null: %v", err)
+	}
+	if b, _ = json.Marshal(patch); string(b) != `{"b":2,"o":{"x":2}}` {
+		t.Fatalf("CreateMergePatch unchanged null: got %s", b)
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	// the example of RFC 7386
+	om := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"title": "Goodbye!", "author": {"givenName": "John", "familyName": "Doe"}, "tags": ["example", "sample"], "content": "This will be unchanged"}`), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	patch := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"title": "Hello!", "phoneNumber": "+01-123-456-7890", "author": {"familyName": null}, "tags": ["example"], "new": {"a": null, "b": 1}}`), patch); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	om.ApplyMergePatch(patch)
+	b, _ := json.Marshal(om)
+	expected := `{"title":"Hello!","author":{"givenName":"John"},"tags":["example"],"content":"This will be unchanged",` +
+		`"phoneNumber":"+01-123-456-7890","new":{"b":1}}`
+	if string(b) != expected {
+		t.Fatalf("ApplyMergePatch: got %s, expected %s", b, expected)
+	}
+}
+
+func TestMergeAll(t *testing.T) {
+	newMap := func(data string) *OrderedMap {
+		om := NewOrderedMap()
+		if err := json.Unmarshal([]byte(data), om); err != nil {
+			t.Fatalf("Unmarshal OrderedMap: %v", err)
+		}
+		return om
+	}
+	defaults := newMap(`{"host": "localhost", "port": 80, "db": {"user": "root", "pool": 1}}`)
+	file := newMap(`{"debug": false, "port": 8080, "db": {"pool": 5, "name": "app"}}`)
+	env := newMap(`{"debug": true, "tls": {"on": true}, "db": {"user": "app"}}`)
+
+	b, _ := json.Marshal(MergeAll(defaults, file, nil, env))
+	if expected := `{"host":"localhost","port":8080,"db":{"user":"app"},"debug":true,"tls":{"on":true}}`; string(b) != expected {
+		t.Fatalf("MergeAll: got %s, expected %s", b, expected)
+	}
+
+	deep := MergeAllDeep(defaults, file, env)
+	b, _ = json.Marshal(deep)
+	if expected := `{"host":"localhost","port":8080,"db":{"user":"app","pool":5,"name":"app"},"debug":true,"tls":{"on":true}}`; string(b) != expected {
+		t.Fatalf("MergeAllDeep: got %s, expected %s", b, expected)
+	}
+	db, _ := deep.GetOrderedMap("db")
+	db.Set("user", "changed")
+	if b, _ = json.Marshal(defaults); string(b) != `{"host":"localhost","port":80,"db":{"user":"root","pool":1}}` {
+		t.Fatalf("MergeAllDeep: the inputs should be untouched, got %s", b)
+	}
+
+	if empty := MergeAll(); empty.Len() != 0 {
+		t.Fatalf("MergeAll no maps: %v", empty.Keys())
+	}
+}
+
+func TestCreateKeyedArrayPatch(t *testing.T) {
+	newItems := func(data string) []*OrderedMap {
+		om := NewOrderedMap()
+		if err := json.Unmarshal([]byte(`{"items": `+data+`}`), om); err != nil {
+			t.Fatalf("Unmarshal OrderedMap: %v", err)
+		}
+		items, _ := om.GetOrderedMapSlice("items")
+		return items
+	}
+	from := newItems(`[{"id": 1, "v": "a"}, {"id": 2, "v": "b"}, {"id": 3, "v": "c"}, {"id": "4", "v": null}]`)
+	to := newItems(`[{"id": 5, "v": "e"}, {"id": 3, "v": "changed"}, {"id": 1, "v": "a"}, {"id": 4, "v": null}, {"id": 6}]`)
+
+	added, removed, changed, err := CreateKeyedArrayPatch(from, to, "id")
+	if err != nil {
+		t.Fatalf("CreateKeyedArrayPatch: %v", err)
+	}
+	marshal := func(items []*OrderedMap) string {
+		b, _ := json.Marshal(items)
+		return string(b)
+	}
+	if got := marshal(added); got != `[{"id":5,"v":"e"},{"id":6}]` {
+		t.Fatalf("CreateKeyedArrayPatch added: got %s", got)
+	}
+	if got := marshal(removed); got != `[{"id":2,"v":"b"}]` {
+		t.Fatalf("CreateKeyedArrayPatch removed: got %s", got)
+	}
+	// "4" and 4 are the same id, but the elements differ
+	if got := marshal(changed); got != `[{"id":3,"v":"changed"},{"id":4,"v":null}]` {
+		t.Fatalf("CreateKeyedArrayPatch changed: got %s", got)
+	}
+	if changed[0] != to[1] {
+		t.Fatal("CreateKeyedArrayPatch: expect the elements of to, not copies")
+	}
+
+	if added, removed, changed, err = CreateKeyedArrayPatch(nil, nil, "id"); err != nil || len(added)+len(removed)+len(changed) != 0 {
+		t.Fatalf("CreateKeyedArrayPatch empty: %v %v %v %v", added, removed, changed, err)
+	}
+
+	missing := newItems(`[{"id": 1}, {"name": "no id"}]`)
+	if _, _, _, err = CreateKeyedArrayPatch(from, missing, "id"); err == nil || err.Error() != `element 1 of to has no key "id"` {
+		t.Fatalf("CreateKeyedArrayPatch missing id: got %v", err)
+	}
+	if _, _, _, err = CreateKeyedArrayPatch(missing, to, "id"); err == nil {
+		t.Fatal("CreateKeyedArrayPatch missing id in from: expect an error")
+	}
+	if _, _, _, err = CreateKeyedArrayPatch(newItems(`[{"id": 1}, {"id": "1"}]`), to, "id"); err == nil {
+		t.Fatal("CreateKeyedArrayPatch duplicate id: expect an error")
+	}
+}
@@ -18,9 +18,16 @@ package ordered
 import (
 	"bytes"
 	"container/list"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"iter"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
 )
 
 // the key-value pair type, for initializing from a list of key-value pairs, or for looping entries in the same order
@@ -37,8 +44,55 @@ type OrderedMap struct {
 	m
 	l    *list.List
 	keys map[string]*list.Element // the double linked list for delete and lookup to be O(1)
+	meta map[string]*keyMeta      // the optional per-key metadata, nil until any is attached
+
+	frozen  bool          // read-only, see Freeze
+	history *historyLog   // the mutations recorded, nil until EnableHistory
+	cache   *marshalCache // the bytes last marshalled, nil until EnableMarshalCache
+}
+
+// the metadata attached to a key, beside its value
+type keyMeta struct {
+	comment string
+	rawKey  []byte // the key as quoted in the input, decoded with DecodeOptions.RawKeys
+}
+
+// the metadata of the key, attached if none yet
+func (om *OrderedMap) metaOf(key string) *keyMeta {
+	if om.meta == nil {
+		om.meta = make(map[string]*keyMeta)
+	}
+	meta, ok := om.meta[key]
+	if !ok {
+		meta = &keyMeta{}
+		om.meta[key] = meta
+	}
+	return meta
+}
+
+// called by every method before changing the map, the op named in the panic of a frozen map
+func (om *OrderedMap) modify(op string) {
+	if om.frozen {
+		panic(fmt.Sprintf("%s on a frozen OrderedMap", op))
+	}
+	if om.cache != nil {
+		om.cache.b = nil
+	}
+}
+
+// the core operations of OrderedMap, so callers may accept the interface and use a fake in tests
+type Map interface {
+	Get(key string) interface{}
+	Set(key string, value interface{})
+	Delete(key string) (value interface{}, ok bool)
+	Keys() []string
+	Len() int
+	Has(key string) bool
+	MarshalJSON() ([]byte, error)
 }
 
+var _ Map = (*OrderedMap)(nil)
+
 // Create a new OrderedMap
 func NewOrderedMap() *OrderedMap {
 	return &OrderedMap{
@@ -48,6 +102,15 @@ func NewOrderedMap() *OrderedMap {
 	}
 }
 
+// empty the map, also makes a zero value OrderedMap usable
+func (om *OrderedMap) reset() {
+	om.modify("Unmarshal")
+	om.m = make(map[string]interface{})
+	om.l = list.New()
+	om.keys = make(map[string]*list.Element)
+	om.meta = nil
+}
+
 // Create a new OrderedMap and populate from a list of key-value pairs
 func NewOrderedMapFromKVPairs(pairs []*KVPair) *OrderedMap {
 	om := NewOrderedMap()
@@ -57,16 +120,393 @@ func NewOrderedMapFromKVPairs(pairs []*KVPair) *OrderedMap {
 	return om
 }
 
-// return all keys
-// func (om *OrderedMap) Keys() []string { return om.keys }
+// return all keys, in the same order of keys inserted
+func (om *OrderedMap) Keys() []string {
+	keys := make([]string, 0, om.l.Len())
+	for e := om.l.Front(); e != nil; e = e.Next() {
+		keys = append(keys, e.Value.(string))
+	}
+	return keys
+}
+
+// return the keys not in snapshot, such as the Keys got earlier, in the same order of keys inserted;
+// the keys of snapshot deleted since are not reported
+func (om *OrderedMap) NewKeysSince(snapshot []string) []string {
+	old := make(map[string]bool, len(snapshot))
+	for _, key := range snapshot {
+		old[key] = true
+	}
+	res := make([]string, 0)
+	for e := om.l.Front(); e != nil; e = e.Next() {
+		if key := e.Value.(string); !old[key] {
+			res = append(res, key)
+		}
+	}
+	return res
+}
+
+// return the number of keys
+func (om *OrderedMap) Len() int {
+	return len(om.m)
+}
 
 // set value for particular key, this will remember the order of keys inserted
 // but if the key already exists, the order is not updated.
 func (om *OrderedMap) Set(key string, value interface{}) {
-	if _, ok := om.m[key]; !ok {
+	om.modify("Set")
+	old, ok := om.m[key]
+	if !ok {
 		om.keys[key] = om.l.PushBack(key)
 	}
 	om.m[key] = value
+	if om.history != nil {
+		om.history.recordSet(key, old, value, ok)
+	}
+}
+
+// set the child map as the nested object of key, same as Set: a new key is appended, an existing one
+// keeps its position; the child is stored as is, not copied, so GetOrderedMap gets it back
+func (om *OrderedMap) Nest(key string, child *OrderedMap) {
+	om.Set(key, child)
+}
+
+// set value for particular key and put the key at the front of the order,
+// unlike Set, an existing key is moved to the front too
+func (om *OrderedMap) Prepend(key string, value interface{}) {
+	om.modify("Prepend")
+	if e, ok := om.keys[key]; ok {
+		om.l.MoveToFront(e)
+	} else {
+		om.keys[key] = om.l.PushFront(key)
+	}
+	om.m[key] = value
+}
+
+// reorder the keys: the existing keys of priority first, in the order given, then all other keys sorted ascending
+func (om *OrderedMap) ReorderByPriority(priority []string) {
+	om.modify("ReorderByPriority")
+	first := make(map[string]bool, len(priority))
+	for _, key := range priority {
+		if e, ok := om.keys[key]; ok && !first[key] {
+			first[key] = true
+			om.l.MoveToBack(e)
+		}
+	}
+	rest := make([]string, 0, len(om.keys)-len(first))
+	for key := range om.keys {
+		if !first[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	for _, key := range rest {
+		om.l.MoveToBack(om.keys[key])
+	}
+}
+
+// update the value of an existing key, keeping its position; unlike Set, it returns an error
+// if the key does not exist, instead of inserting it
+func (om *OrderedMap) Replace(key string, value interface{}) error {
+	if _, ok := om.m[key]; !ok {
+		return fmt.Errorf("key %q does not exist", key)
+	}
+	om.Set(key, value)
+	return nil
+}
+
+// update the element at index of the []interface{} value of key in place, it returns an error if
+// the key does not exist, its value is not an array or the index is out of range
+func (om *OrderedMap) SetArrayElement(key string, index int, value interface{}) error {
+	om.modify("SetArrayElement")
+	v, ok := om.m[key]
+	if !ok {
+		return fmt.Errorf("key %q does not exist", key)
+	}
+	arr, ok := v.([]interface{})
+	if !ok {
+		return fmt.Errorf("value of key %q is not an array: %T", key, v)
+	}
+	if index < 0 || index >= len(arr) {
+		return fmt.Errorf("index %d out of range of key %q with length %d", index, key, len(arr))
+	}
+	arr[index] = value
+	return nil
+}
+
+// sort the []interface{} value of key in place by the value of field of each element, which must all
+// be objects, using less; the sort is stable, and an element missing field is given a nil value. It
+// returns an error if the key does not exist or its value is not an array of objects
+func (om *OrderedMap) SortArrayBy(key, field string, less func(a, b interface{}) bool) error {
+	om.modify("SortArrayBy")
+	v, ok := om.m[key]
+	if !ok {
+		return fmt.Errorf("key %q does not exist", key)
+	}
+	arr, ok := v.([]interface{})
+	if !ok {
+		return fmt.Errorf("value of key %q is not an array: %T", key, v)
+	}
+	elems := make([]*OrderedMap, len(arr))
+	for i, elem := range arr {
+		if elems[i], ok = elem.(*OrderedMap); !ok || elems[i] == nil {
+			return fmt.Errorf("element %d of key %q is not an object: %T", i, key, elem)
+		}
+	}
+	sort.SliceStable(elems, func(i, j int) bool {
+		return less(elems[i].m[field], elems[j].m[field])
+	})
+	for i, elem := range elems {
+		arr[i] = elem
+	}
+	return nil
+}
+
+// Create a deep copy of the map, nested OrderedMap, []interface{}, []*OrderedMap and map[string]interface{} values
+// are copied recursively, other values are copied as is
+func (om *OrderedMap) Clone() *OrderedMap {
+	res := NewOrderedMap()
+	for e := om.l.Front(); e != nil; e = e.Next() {
+		key := e.Value.(string)
+		res.Set(key, cloneValue(om.m[key]))
+	}
+	res.copyMeta(om)
+	return res
+}
+
+// Create a shallow copy of the map: the keys, their order and comments are copied, so setting or deleting
+// a key of one never affects the other, but the values are shared as is, so a nested OrderedMap or
+// []interface{} is the same in both and mutating it affects both; cheaper than Clone when the nested
+// values are only read
+func (om *OrderedMap) ShallowCopy() *OrderedMap {
+	res := NewOrderedMap()
+	for e := om.l.Front(); e != nil; e = e.Next() {
+		key := e.Value.(string)
+		res.Set(key, om.m[key])
+	}
+	res.copyMeta(om)
+	return res
+}
+
+func (om *OrderedMap) copyMeta(from *OrderedMap) {
+	for key, meta := range from.meta {
+		if om.meta == nil {
+			om.meta = make(map[string]*keyMeta, len(from.meta))
+		}
+		copied := *meta
+		om.meta[key] = &copied
+	}
+}
+
+func cloneValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *OrderedMap:
+		if v == nil {
+			return v
+		}
+		return v.Clone()
+	case []interface{}:
+		if v == nil {
+			return v
+		}
+		arr := make([]interface{}, len(v))
+		for i := range v {
+			arr[i] = cloneValue(v[i])
+		}
+		return arr
+	case []*OrderedMap:
+		if v == nil {
+			return v
+		}
+		maps := make([]*OrderedMap, len(v))
+		for i := range v {
+			if v[i] != nil {
+				maps[i] = v[i].Clone()
+			}
+		}
+		return maps
+	case map[string]interface{}:
+		if v == nil {
+			return v
+		}
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[key] = cloneValue(value)
+		}
+		return m
+	}
+	return v
+}
+
+// report whether the map has the same keys in the same order as other, with equal values; nested OrderedMap
+// and []interface{} values are compared the same way recursively, other values by reflect.DeepEqual,
+// so json.Number("1") and 1 are different. Comments and other per-key metadata are ignored
+func (om *OrderedMap) Equal(other *OrderedMap) bool {
+	if om == nil || other == nil {
+		return om == other
+	}
+	if om.l.Len() != other.l.Len() {
+		return false
+	}
+	for e, o := om.l.Front(), other.l.Front(); e != nil; e, o = e.Next(), o.Next() {
+		key := e.Value.(string)
+		if key != o.Value.(string) || !equalValues(om.m[key], other.m[key]) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalValues(a, b interface{}) bool {
+	switch a := a.(type) {
+	case *OrderedMap:
+		b, ok := b.(*OrderedMap)
+		return ok && a.Equal(b)
+	case []interface{}:
+		b, ok := b.([]interface{})
+		return ok && equalArrays(a, b)
+	case MultiValue:
+		b, ok := b.(MultiValue)
+		return ok && equalArrays(a, b)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func equalArrays(a, b []interface{}) bool {
+	if len(a) != len(b) || (a == nil) != (b == nil) {
+		return false
+	}
+	for i := range a {
+		if !equalValues(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// report whether every key of the map exists in other with an equal value, whatever the keys order and
+// the other keys of other; nested objects are compared the same way, arrays element by element, and
+// numbers by value whatever their type, such as json.Number("1") and 1
+func (om *OrderedMap) IsSubsetOf(other *OrderedMap) bool {
+	if om == nil || other == nil {
+		return om == nil
+	}
+	for e := om.l.Front(); e != nil; e = e.Next() {
+		key := e.Value.(string)
+		value, ok := other.m[key]
+		if !ok || !subsetValue(om.m[key], value) {
+			return false
+		}
+	}
+	return true
+}
+
+func subsetValue(a, b interface{}) bool {
+	switch a := a.(type) {
+	case *OrderedMap:
+		b, ok := b.(*OrderedMap)
+		return ok && a.IsSubsetOf(b) && (a == nil) == (b == nil)
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !subsetValue(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return leafEqual(a, b)
+}
+
+// Get a clone of the nested OrderedMap at the key path, ok only if every key exists
+// and the path ends on an object; as a clone, mutating it never affects the original
+func (om *OrderedMap) SubTree(path ...string) (*OrderedMap, bool) {
+	cur := om
+	for _, key := range path {
+		next, ok := cur.m[key].(*OrderedMap)
+		if !ok || next == nil {
+			return nil, false
+		}
+		cur = next
+	}
+	return cur.Clone(), true
+}
+
+// return the keys matching a path.Match style glob pattern (such as "db.*" or "*.host"),
+// in the same order of keys inserted; an error is returned only if the pattern is malformed
+func (om *OrderedMap) KeysMatching(pattern string) ([]string, error) {
+	// validate the pattern even when there is no key to match against
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0)
+	for e := om.l.Front(); e != nil; e = e.Next() {
+		key := e.Value.(string)
+		if ok, _ := path.Match(pattern, key); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// return the longest prefix of whole sep separated segments shared by all keys, such as "app.db" for
+// the keys "app.db.host" and "app.db.port" with sep "."; empty if the keys differ in the first segment
+// or the map is empty, the key itself if there is one key only
+func (om *OrderedMap) CommonKeyPrefix(sep string) string {
+	var prefix []string
+	for e := om.l.Front(); e != nil; e = e.Next() {
+		segments := strings.Split(e.Value.(string), sep)
+		if e == om.l.Front() {
+			prefix = segments
+			continue
+		}
+		n := 0
+		for n < len(prefix) && n < len(segments) && prefix[n] == segments[n] {
+			n++
+		}
+		if prefix = prefix[:n]; n == 0 {
+			break
+		}
+	}
+	return strings.Join(prefix, sep)
+}
+
+// return the value of the first key present with a non-empty value, for fallbacks such as "displayName",
+// "name" then "login"; empty the same as omitempty of encoding/json: false, 0, "", nil, an empty array
+// or map, and an OrderedMap without keys; not ok if no key qualifies
+func (om *OrderedMap) Coalesce(keys ...string) (value interface{}, key string, ok bool) {
+	for _, key = range keys {
+		if value, ok = om.m[key]; ok && !isEmptyValue(value) {
+			return value, key, true
+		}
+	}
+	return nil, "", false
+}
+
+func isEmptyValue(v interface{}) bool {
+	if om, ok := v.(*OrderedMap); ok {
+		return om == nil || om.Len() == 0
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Bool:
+		return !rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return rv.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return rv.IsNil()
+	}
+	return false
 }
 
 // Check if value exists
@@ -75,6 +515,33 @@ func (om *OrderedMap) Has(key string) bool {
 	return ok
 }
 
+// Check if the key exists with a value equal to expected: numbers of any type are compared by value, so
+// json.Number("3") equals int(3) and float64(3), other values are compared deeply
+func (om *OrderedMap) ValueEquals(key string, expected interface{}) bool {
+	value, ok := om.m[key]
+	return ok && leafEqual(value, expected)
+}
+
+// Check if all of the keys exist, true for no keys at all
+func (om *OrderedMap) HasAll(keys ...string) bool {
+	for _, key := range keys {
+		if _, ok := om.m[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Check if any of the keys exists, false for no keys at all
+func (om *OrderedMap) HasAny(keys ...string) bool {
+	for _, key := range keys {
+		if _, ok := om.m[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
 // Get value for particular key, or nil if not exist; but don't rely on nil for non-exist; should check by Has or GetValue
 func (om *OrderedMap) Get(key string) interface{} {
 	return om.m[key]
@@ -86,6 +553,79 @@ func (om *OrderedMap) GetValue(key string) (value interface{}, ok bool) {
 	return
 }
 
+// Get the JSON type of the value for particular key, one of "string", "number", "bool", "null", "object"
+// and "array"; a json.Number is a "number", a nested OrderedMap is an "object"; not ok if not exist
+func (om *OrderedMap) ValueType(key string) (string, bool) {
+	value, ok := om.m[key]
+	if !ok {
+		return "", false
+	}
+	return jsonType(value), true
+}
+
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "bool"
+	case *OrderedMap:
+		if v == nil {
+			return "null"
+		}
+		return "object"
+	case []interface{}, MultiValue:
+		return "array"
+	case json.RawMessage:
+		switch b := bytes.TrimSpace(v); {
+		case len(b) == 0:
+			return "null"
+		case b[0] == '{':
+			return "object"
+		case b[0] == '[':
+			return "array"
+		case b[0] == '"':
+			return "string"
+		case b[0] == 't' || b[0] == 'f':
+			return "bool"
+		case b[0] == 'n':
+			return "null"
+		}
+		return "number"
+	}
+	// any other Go value by how json.Marshal encodes its kind
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return "null"
+		}
+		return jsonType(rv.Elem().Interface())
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "bool"
+	case reflect.Struct, reflect.Map:
+		return "object"
+	case reflect.Slice:
+		if rv.IsNil() {
+			return "null"
+		}
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			// []byte marshals as a base64 string
+			return "string"
+		}
+		return "array"
+	case reflect.Array:
+		return "array"
+	}
+	return "number"
+}
+
 // Get json value for particular key, or nil if not exist; but don't rely on nil for non-exist; should check by Has or GetValue
 func (om *OrderedMap) GetJson(key string) string {
 	jsonByte, err := json.Marshal(om.m[key])
@@ -134,6 +674,20 @@ func (om *OrderedMap) GetJsonByteValue(key string) ([]byte, bool) {
 	return jsonByte, ok
 }
 
+// Get the value for particular key marshalled back to JSON bytes, nested OrderedMap values keep their keys order;
+// not ok if not exist, or the value cannot be marshalled
+func (om *OrderedMap) GetRawMessage(key string) (json.RawMessage, bool) {
+	value, ok := om.m[key]
+	if !ok {
+		return nil, false
+	}
+	e := newEncoder(MarshalOptions{})
+	if err := e.encodeValue(value); err != nil {
+		return nil, false
+	}
+	return json.RawMessage(e.buf), true
+}
+
 // Get map[string]interface{} value for particular key, or nil if not exist; but don't rely on nil for non-exist; should check by Has or GetValue
 func (om *OrderedMap) GetMap(key string) map[string]interface{} {
 	return toMap(om.GetJsonByte(key))
@@ -148,6 +702,126 @@ func (om *OrderedMap) GetMapValue(key string) (map[string]interface{}, bool) {
 	return toMap(jsonByte), ok
 }
 
+// Get []byte value for particular key decoded from a base64 string, as json.Marshal encodes a []byte;
+// a []byte value set as is is returned too; not ok if not exist, or the value is not base64 data
+func (om *OrderedMap) GetBytes(key string) ([]byte, bool) {
+	switch v := om.m[key].(type) {
+	case []byte:
+		return v, true
+	case string:
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, false
+		}
+		return b, true
+	}
+	return nil, false
+}
+
+// Get time.Duration value for particular key parsed from a string such as "30s" or "1h5m" by time.ParseDuration;
+// not ok if not exist, the value is not a string, or it doesn't parse
+func (om *OrderedMap) GetDuration(key string) (time.Duration, bool) {
+	s, ok := om.m[key].(string)
+	if !ok {
+		return 0, false
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, false
+	}
+	return d, true
+}
+
+// Get []string value for particular key, ok only if the value is an array and all of its elements are strings
+func (om *OrderedMap) GetStringSlice(key string) ([]string, bool) {
+	arr, ok := om.m[key].([]interface{})
+	if !ok {
+		return nil, false
+	}
+	res := make([]string, 0, len(arr))
+	for _, v := range arr {
+		s, ok := v.(string)
+		if !ok {
+			return nil, false
+		}
+		res = append(res, s)
+	}
+	return res, true
+}
+
+// Get *OrderedMap value for particular key, ok only if the value is an object; a json.RawMessage value,
+// as kept by DecodeOptions.MaxDecodeDepth, is decoded and the result stored back in place of the raw bytes,
+// unless the map is frozen, then the result is frozen too and decoded again on every call
+func (om *OrderedMap) GetOrderedMap(key string) (*OrderedMap, bool) {
+	switch v := om.m[key].(type) {
+	case *OrderedMap:
+		return v, v != nil
+	case json.RawMessage:
+		res := NewOrderedMap()
+		if err := res.UnmarshalJSON(v); err != nil {
+			return nil, false
+		}
+		if om.frozen {
+			res.Freeze()
+		} else {
+			om.m[key] = res
+		}
+		return res, true
+	}
+	return nil, false
+}
+
+// Get []*OrderedMap value for particular key, ok only if the value is an array and all of its elements are objects
+func (om *OrderedMap) GetOrderedMapSlice(key string) ([]*OrderedMap, bool) {
+	arr, ok := om.m[key].([]interface{})
+	if !ok {
+		return nil, false
+	}
+	res := make([]*OrderedMap, 0, len(arr))
+	for _, v := range arr {
+		elem, ok := v.(*OrderedMap)
+		if !ok {
+			return nil, false
+		}
+		res = append(res, elem)
+	}
+	return res, true
+}
+
+// Get the field value of every element of the array of objects for particular key, nil for an element
+// missing the field; ok only if the value is an array and all of its elements are objects
+func (om *OrderedMap) Pluck(arrayKey, field string) ([]interface{}, bool) {
+	elems, ok := om.GetOrderedMapSlice(arrayKey)
+	if !ok {
+		return nil, false
+	}
+	res := make([]interface{}, len(elems))
+	for i, elem := range elems {
+		res[i] = elem.Get(field)
+	}
+	return res, true
+}
+
+// Get []T value for particular key, each element of the array is marshalled back to JSON and unmarshalled into T;
+// not ok if not exist, the value is not an array, or any element does not unmarshal into T
+func GetTypedSlice[T any](om *OrderedMap, key string) ([]T, bool) {
+	arr, ok := om.m[key].([]interface{})
+	if !ok {
+		return nil, false
+	}
+	res := make([]T, len(arr))
+	for i, v := range arr {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, false
+		}
+		if err = json.Unmarshal(b, &res[i]); err != nil {
+			return nil, false
+		}
+	}
+	return res, true
+}
+
 // []byte to map[string]interface{}
 func toMap(jsonByte []byte) map[string]interface{} {
 	var origin map[string]interface{}
@@ -160,16 +834,31 @@ func toMap(jsonByte []byte) map[string]interface{} {
 }
 
 // deletes the element with the specified key (m[key]) from the map. If there is no such element, this is a no-op.
+// The keys order is a linked list indexed by key, so a key is unlinked in O(1) without shifting the others,
+// and deleting many keys in a loop stays linear; there is no need for tombstones or a compaction
 func (om *OrderedMap) Delete(key string) (value interface{}, ok bool) {
+	om.modify("Delete")
 	value, ok = om.m[key]
 	if ok {
+		if om.history != nil {
+			om.history.record(HistoryEvent{Op: HistoryDelete, Key: key, OldValue: value, Index: om.indexOf(key)})
+		}
 		om.l.Remove(om.keys[key])
 		delete(om.keys, key)
 		delete(om.m, key)
+		delete(om.meta, key)
 	}
 	return
 }
 
+// delete all the listed keys from the map, keeping the order of the rest; keys not in the map are ignored.
+// Each key is unlinked from the keys list in O(1), so this is O(k) for k keys
+func (om *OrderedMap) DeleteMany(keys ...string) {
+	for _, key := range keys {
+		om.Delete(key)
+	}
+}
+
 // Iterate all key/value pairs in the same order of object constructed
 func (om *OrderedMap) EntriesIter() func() (*KVPair, bool) {
 	e := om.l.Front()
@@ -196,57 +885,141 @@ func (om *OrderedMap) EntriesReverseIter() func() (*KVPair, bool) {
 	}
 }
 
-// this implements type json.Marshaler interface, so can be called in json.Marshal(om)
-func (om *OrderedMap) MarshalJSON() (res []byte, err error) {
-	res = append(res, '{')
-	front, back := om.l.Front(), om.l.Back()
-	for e := front; e != nil; e = e.Next() {
-		k := e.Value.(string)
-		res = append(res, fmt.Sprintf("%q:", k)...)
-		var b []byte
-		b, err = json.Marshal(om.m[k])
-		if err != nil {
-			return
+// call fn for all key/value pairs in the same order of object constructed,
+// stop at the first error returned by fn and return it, or nil if fn never fails
+func (om *OrderedMap) Process(fn func(key string, value interface{}) error) error {
+	for e := om.l.Front(); e != nil; {
+		key := e.Value.(string)
+		// step before calling fn, so fn may delete the current key
+		e = e.Next()
+		if err := fn(key, om.m[key]); err != nil {
+			return err
 		}
-		res = append(res, b...)
-		if e != back {
-			res = append(res, ',')
+	}
+	return nil
+}
+
+// call fn for every key/value pair in order, storing the newValue it returns in place of the value
+// when replace is true; the keys order is untouched
+func (om *OrderedMap) Update(fn func(key string, value interface{}) (newValue interface{}, replace bool)) {
+	om.modify("Update")
+	for e := om.l.Front(); e != nil; e = e.Next() {
+		key := e.Value.(string)
+		if value, replace := fn(key, om.m[key]); replace {
+			om.m[key] = value
 		}
 	}
-	res = append(res, '}')
-	// fmt.Printf("marshalled: %v: %#v\n", res, res)
-	return
 }
 
-// this implements type json.Unmarshaler interface, so can be called in json.Unmarshal(data, om)
-func (om *OrderedMap) UnmarshalJSON(data []byte) error {
-	dec := json.NewDecoder(bytes.NewReader(data))
-	dec.UseNumber()
+// return the first key/value pair in order for which pred returns true, not ok if none matches
+func (om *OrderedMap) Find(pred func(key string, value interface{}) bool) (key string, value interface{}, ok bool) {
+	for e := om.l.Front(); e != nil; e = e.Next() {
+		key = e.Value.(string)
+		if pred(key, om.m[key]) {
+			return key, om.m[key], true
+		}
+	}
+	return "", nil, false
+}
 
-	// must open with a delim token '{'
-	t, err := dec.Token()
-	if err != nil {
-		return err
+// split the map into two new maps, matched with the key/value pairs for which pred returns true and rest
+// with the others, both in the same relative order; the values are shared with the map, not copied
+func (om *OrderedMap) Partition(pred func(key string, value interface{}) bool) (matched, rest *OrderedMap) {
+	matched, rest = NewOrderedMap(), NewOrderedMap()
+	for e := om.l.Front(); e != nil; e = e.Next() {
+		key := e.Value.(string)
+		if pred(key, om.m[key]) {
+			matched.Set(key, om.m[key])
+		} else {
+			rest.Set(key, om.m[key])
+		}
 	}
-	if delim, ok := t.(json.Delim); !ok || delim != '{' {
-		return fmt.Errorf("expect JSON object open with '{'")
+	return matched, rest
+}
+
+// build the reverse lookup of the scalar values, from the string of each value (formatted by fmt.Sprint
+// unless a string, same as GroupBy) to the keys holding it in the same order of keys inserted; the
+// objects and arrays are skipped
+func (om *OrderedMap) InvertScalar() map[string][]string {
+	res := make(map[string][]string)
+	for e := om.l.Front(); e != nil; e = e.Next() {
+		key := e.Value.(string)
+		value := om.m[key]
+		if t := jsonType(value); t == "object" || t == "array" {
+			continue
+		}
+		s := toString(value)
+		res[s] = append(res[s], key)
 	}
+	return res
+}
 
-	err = om.parseobject(dec)
-	if err != nil {
-		return err
+// split the map into new maps of at most size keys each, such as for batching, in the same order of keys
+// inserted; a non-positive size doesn't split the map, returning a single chunk of all keys, and an empty
+// map returns no chunks. The values are shared with the map, not copied
+func (om *OrderedMap) Chunk(size int) []*OrderedMap {
+	if size <= 0 {
+		size = om.l.Len()
 	}
+	chunks := make([]*OrderedMap, 0)
+	var cur *OrderedMap
+	for e := om.l.Front(); e != nil; e = e.Next() {
+		if cur == nil || cur.l.Len() == size {
+			cur = NewOrderedMap()
+			chunks = append(chunks, cur)
+		}
+		key := e.Value.(string)
+		cur.Set(key, om.m[key])
+	}
+	return chunks
+}
 
-	t, err = dec.Token()
-	if err != io.EOF {
-		return fmt.Errorf("expect end of JSON object but got more token: %T: %v or err: %v", t, t, err)
+// Iterate the index and key/value pair of all entries in the same order of object constructed, as a range-over-func
+// iterator: for i, kv := range om.Enumerate(); the index counts from 0, breaking the loop stops the iteration
+func (om *OrderedMap) Enumerate() iter.Seq2[int, KVPair] {
+	return func(yield func(int, KVPair) bool) {
+		i := 0
+		for e := om.l.Front(); e != nil; e = e.Next() {
+			key := e.Value.(string)
+			if !yield(i, KVPair{key, om.m[key]}) {
+				return
+			}
+			i++
+		}
 	}
+}
 
-	return nil
+// this implements type json.Marshaler interface, so can be called in json.Marshal(om)
+func (om *OrderedMap) MarshalJSON() (res []byte, err error) {
+	e := newEncoder(MarshalOptions{})
+	e.useCache = true
+	if err := e.encodeMap(om); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
 }
 
-func (om *OrderedMap) parseobject(dec *json.Decoder) (err error) {
+// this implements type json.Unmarshaler interface, so can be called in json.Unmarshal(data, om);
+// any existing content of the map is reset first, use UnmarshalMerge to keep it
+func (om *OrderedMap) UnmarshalJSON(data []byte) error {
+	return om.UnmarshalWithOptions(data, DecodeOptions{})
+}
+
+func (om *OrderedMap) parseobject(dec *decoder) (err error) {
 	var t json.Token
+	policy := DuplicateKeys
+	if dec.opts.PreserveDuplicates {
+		policy = Combine
+	}
+	var seen map[string]bool
+	if policy != KeepLast {
+		seen = make(map[string]bool)
+	}
+	// the end of the previous token, as More skips over the spaces and comments before a key
+	offset := dec.InputOffset()
+	// the key of the previous member, taking the comments on the line of its value
+	var prev string
+	var hasPrev bool
 	for dec.More() {
 		t, err = dec.Token()
 		if err != nil {
@@ -257,23 +1030,66 @@ func (om *OrderedMap) parseobject(dec *json.Decoder) (err error) {
 		if !ok {
 			return fmt.Errorf("expecting JSON key should be always a string: %T: %v", t, t)
 		}
+		var comment string
+		if dec.comments != nil {
+			var trailing string
+			trailing, comment = dec.commentsSince(offset)
+			if hasPrev {
+				om.appendComment(prev, trailing)
+			} else if comment == "" {
+				// after the '{', such as `{ // about the object`, so before the first key
+				comment = trailing
+			} else if trailing != "" {
+				comment = trailing + "\n" + comment
+			}
+		}
+		var rawKey []byte
+		if dec.opts.LowercaseKeys {
+			key = strings.ToLower(key)
+		} else if dec.data != nil {
+			rawKey = dec.rawKey(offset, key)
+		}
 
-		t, err = dec.Token()
+		var value interface{}
+		value, err = dec.value()
 		if err == io.EOF {
 			break
 		} else if err != nil {
 			return err
 		}
 
-		var value interface{}
-		value, err = handledelim(t, dec)
-		if err != nil {
-			return err
+		if seen[key] {
+			switch policy {
+			case KeepFirst:
+				prev, hasPrev = key, true
+				offset = dec.InputOffset()
+				continue
+			case Error:
+				return fmt.Errorf("duplicate key %q in JSON object", key)
+			case Combine:
+				multi, ok := om.m[key].(MultiValue)
+				if !ok {
+					multi = MultiValue{om.m[key]}
+				}
+				value = append(multi, value)
+			}
+		}
+		if seen != nil {
+			seen[key] = true
+		}
+		// a duplicate key keeps its first position, same as Set
+		if _, ok := om.m[key]; !ok {
+			om.keys[key] = om.l.PushBack(key)
+			if rawKey != nil {
+				om.metaOf(key).rawKey = rawKey
+			}
 		}
-
-		// om.keys = append(om.keys, key)
-		om.keys[key] = om.l.PushBack(key)
 		om.m[key] = value
+		if comment != "" {
+			om.SetComment(key, comment)
+		}
+		prev, hasPrev = key, true
+		offset = dec.InputOffset()
 	}
 
 	t, err = dec.Token()
@@ -283,21 +1099,20 @@ func (om *OrderedMap) parseobject(dec *json.Decoder) (err error) {
 	if delim, ok := t.(json.Delim); !ok || delim != '}' {
 		return fmt.Errorf("expect JSON object close with '}'")
 	}
+	if dec.comments != nil && hasPrev {
+		trailing, _ := dec.commentsSince(offset)
+		om.appendComment(prev, trailing)
+	}
 
 	return nil
 }
 
-func parsearray(dec *json.Decoder) (arr []interface{}, err error) {
+func parsearray(dec *decoder) (arr []interface{}, err error) {
 	var t json.Token
 	arr = make([]interface{}, 0)
 	for dec.More() {
-		t, err = dec.Token()
-		if err != nil {
-			return
-		}
-
 		var value interface{}
-		value, err = handledelim(t, dec)
+		value, err = dec.value()
 		if err != nil {
 			return
 		}
@@ -315,19 +1130,23 @@ func parsearray(dec *json.Decoder) (arr []interface{}, err error) {
 	return
 }
 
-func handledelim(t json.Token, dec *json.Decoder) (res interface{}, err error) {
+func handledelim(t json.Token, dec *decoder) (res interface{}, err error) {
 	if delim, ok := t.(json.Delim); ok {
 		switch delim {
 		case '{':
 			om2 := NewOrderedMap()
+			dec.depth++
 			err = om2.parseobject(dec)
+			dec.depth--
 			if err != nil {
 				return
 			}
 			return om2, nil
 		case '[':
 			var value []interface{}
+			dec.depth++
 			value, err = parsearray(dec)
+			dec.depth--
 			if err != nil {
 				return
 			}
@@ -8,6 +8,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestMarshalOrderedMap(t *testing.T) {
@@ -188,7 +189,7 @@ func TestUnmarshalOrderedMap(t *testing.T) {
 	// check by Has and GetValue
 	for _, kv := range pairs {
 		if !om.Has(kv.Key) {
-			t.Fatalf("expect key %q exists in Unmarshaled OrderedMap")
+			t.Fatalf("expect key %q exists in Unmarshaled OrderedMap", kv.Key)
 		}
 		value, ok := om.GetValue(kv.Key)
 		if !ok || value != kv.Value {
@@ -473,4 +474,968 @@ func TestOrigin(t *testing.T) {
 	fmt.Println(om.GetJsonByteValue("properties"))
 	fmt.Println(om.GetMap("properties"))
 	fmt.Println(om.GetMapValue("properties"))
-}
\ No newline at end of file
+}
+func TestKeysMatching(t *testing.T) {
+	om := NewOrderedMapFromKVPairs([]*KVPair{
+		{"db.host", "localhost"},
+		{"cache.host", "127.0.0.1"},
+		{"db.port", 5432},
+		{"name", "app"},
+	})
+
+	for _, tt := range []struct {
+		pattern  string
+		expected []string
+	}{
+		{"db.*", []string{"db.host", "db.port"}},
+		{"*.host", []string{"db.host", "cache.host"}},
+		{"web.*", []string{}},
+	} {
+		keys, err := om.KeysMatching(tt.pattern)
+		if err != nil {
+			t.Fatalf("KeysMatching %q: %v", tt.pattern, err)
+		}
+		if !reflect.DeepEqual(keys, tt.expected) {
+			t.Fatalf("KeysMatching %q: %q not equal to expected %q", tt.pattern, keys, tt.expected)
+		}
+	}
+
+	if _, err := om.KeysMatching("db.[a-"); err == nil {
+		t.Fatal("KeysMatching: expecting error for invalid pattern")
+	}
+}
+
+func TestGetStringSlice(t *testing.T) {
+	om := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"tags": ["a", "b", "c"], "mixed": ["a", 1], "empty": [], "name": "x"}`), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+
+	tags, ok := om.GetStringSlice("tags")
+	if !ok || !reflect.DeepEqual(tags, []string{"a", "b", "c"}) {
+		t.Fatalf("GetStringSlice tags: %q %v", tags, ok)
+	}
+	if mixed, ok := om.GetStringSlice("mixed"); ok {
+		t.Fatalf("GetStringSlice mixed: expect not ok but got %q", mixed)
+	}
+	empty, ok := om.GetStringSlice("empty")
+	if !ok || empty == nil || len(empty) != 0 {
+		t.Fatalf("GetStringSlice empty: expect an empty slice but got %#v %v", empty, ok)
+	}
+	if name, ok := om.GetStringSlice("name"); ok {
+		t.Fatalf("GetStringSlice name: expect not ok for a string value but got %q", name)
+	}
+	if missing, ok := om.GetStringSlice("missing"); ok || missing != nil {
+		t.Fatalf("GetStringSlice missing: expect nil and not ok but got %q %v", missing, ok)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	om := NewOrderedMapFromKVPairs([]*KVPair{{"a", 1}, {"b", 2}, {"c", 3}})
+	if err := om.Replace("b", "two"); err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+	expected := NewOrderedMapFromKVPairs([]*KVPair{{"a", 1}, {"b", "two"}, {"c", 3}})
+	if !reflect.DeepEqual(om, expected) {
+		t.Fatalf("Replace: %#v not deeply equal to expected %#v", om, expected)
+	}
+
+	if err := om.Replace("bb", 4); err == nil {
+		t.Fatal("Replace: expecting error for missing key")
+	}
+	if om.Has("bb") {
+		t.Fatal("Replace: missing key should not be inserted")
+	}
+}
+
+func TestSetArrayElement(t *testing.T) {
+	om := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"a": [1, 2, 3], "b": "x"}`), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	if err := om.SetArrayElement("a", 1, "two"); err != nil {
+		t.Fatalf("SetArrayElement: %v", err)
+	}
+	if b, _ := json.Marshal(om); string(b) != `{"a":[1,"two",3],"b":"x"}` {
+		t.Fatalf("SetArrayElement: got %s", b)
+	}
+
+	for _, index := range []int{-1, 3} {
+		if err := om.SetArrayElement("a", index, 4); err == nil {
+			t.Fatalf("SetArrayElement: expecting error for index %d out of range", index)
+		}
+	}
+	if err := om.SetArrayElement("b", 0, 4); err == nil {
+		t.Fatal("SetArrayElement: expecting error for non-array value")
+	}
+	if err := om.SetArrayElement("c", 0, 4); err == nil {
+		t.Fatal("SetArrayElement: expecting error for missing key")
+	}
+	if b, _ := json.Marshal(om); string(b) != `{"a":[1,"two",3],"b":"x"}` {
+		t.Fatalf("SetArrayElement: failed updates should not change the map, got %s", b)
+	}
+}
+
+func TestNest(t *testing.T) {
+	om := NewOrderedMapFromKVPairs([]*KVPair{{"status", "ok"}, {"data", nil}})
+	child := NewOrderedMapFromKVPairs([]*KVPair{{"z", 1}, {"a", 2}})
+	om.Nest("data", child)
+	om.Nest("meta", NewOrderedMapFromKVPairs([]*KVPair{{"page", 1}}))
+
+	if got, ok := om.GetOrderedMap("data"); !ok || got != child {
+		t.Fatalf("Nest: GetOrderedMap should get the child back, got %v", got)
+	}
+	b, err := json.Marshal(om)
+	if err != nil {
+		t.Fatalf("Marshal OrderedMap: %v", err)
+	}
+	const expected = `{"status":"ok","data":{"z":1,"a":2},"meta":{"page":1}}`
+	if string(b) != expected {
+		t.Fatalf("Nest: got %s, expected %s", b, expected)
+	}
+
+	decoded := NewOrderedMap()
+	if err = json.Unmarshal(b, decoded); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	if b, _ = json.Marshal(decoded); string(b) != expected {
+		t.Fatalf("Nest round trip: got %s, expected %s", b, expected)
+	}
+}
+
+func TestShallowCopy(t *testing.T) {
+	om := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"a": 1, "nested": {"x": 1}, "list": [1, 2]}`), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	om.SetComment("a", "the a")
+
+	copied := om.ShallowCopy()
+	if !copied.Equal(om) || copied.Comment("a") != "the a" {
+		t.Fatalf("ShallowCopy: %#v not equal to %#v", copied, om)
+	}
+
+	copied.Set("a", 2)
+	copied.Set("b", 3)
+	copied.Delete("list")
+	copied.SetComment("a", "changed")
+	if om.Get("a") != json.Number("1") || om.Has("b") || !om.Has("list") || om.Comment("a") != "the a" {
+		t.Fatalf("ShallowCopy: the top level should be independent, got %v", om)
+	}
+	if !reflect.DeepEqual(om.Keys(), []string{"a", "nested", "list"}) {
+		t.Fatalf("ShallowCopy: keys of the original changed: %v", om.Keys())
+	}
+
+	copied.Get("nested").(*OrderedMap).Set("y", 2)
+	if om.Get("nested").(*OrderedMap).Get("y") != 2 {
+		t.Fatal("ShallowCopy: a nested map should be shared")
+	}
+	om.Get("list").([]interface{})[0] = "changed"
+	if restored := om.ShallowCopy(); restored.Get("list").([]interface{})[0] != "changed" {
+		t.Fatal("ShallowCopy: a nested array should be shared")
+	}
+}
+
+func TestSubTree(t *testing.T) {
+	om := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"app": {"db": {"host": "localhost", "ports": [5432, 5433]}, "name": "x"}}`), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+
+	db, ok := om.SubTree("app", "db")
+	if !ok {
+		t.Fatal("SubTree app.db: expect ok")
+	}
+	b, err := json.Marshal(db)
+	if err != nil {
+		t.Fatalf("Marshal OrderedMap: %v", err)
+	}
+	if expected := `{"host":"localhost","ports":[5432,5433]}`; string(b) != expected {
+		t.Fatalf("SubTree app.db: %s not equal to expected %s", b, expected)
+	}
+
+	if _, ok := om.SubTree("app", "name"); ok {
+		t.Fatal("SubTree app.name: expect not ok for a path ending on a scalar")
+	}
+	if _, ok := om.SubTree("app", "missing", "host"); ok {
+		t.Fatal("SubTree app.missing.host: expect not ok for a missing path")
+	}
+
+	// mutating the sub-tree must not affect the original
+	db.Set("host", "remote")
+	db.Get("ports").([]interface{})[0] = 1
+	b, err = json.Marshal(om)
+	if err != nil {
+		t.Fatalf("Marshal OrderedMap: %v", err)
+	}
+	if expected := `{"app":{"db":{"host":"localhost","ports":[5432,5433]},"name":"x"}}`; string(b) != expected {
+		t.Fatalf("SubTree: original changed to %s", b)
+	}
+}
+
+func TestPrepend(t *testing.T) {
+	om := NewOrderedMapFromKVPairs([]*KVPair{{"a", 1}, {"b", 2}, {"c", 3}})
+
+	om.Prepend("z", 0)
+	b, err := json.Marshal(om)
+	if err != nil {
+		t.Fatalf("Marshal OrderedMap: %v", err)
+	}
+	if expected := `{"z":0,"a":1,"b":2,"c":3}`; string(b) != expected {
+		t.Fatalf("Prepend new key: %s not equal to expected %s", b, expected)
+	}
+
+	om.Prepend("c", 30)
+	b, err = json.Marshal(om)
+	if err != nil {
+		t.Fatalf("Marshal OrderedMap: %v", err)
+	}
+	if expected := `{"c":30,"z":0,"a":1,"b":2}`; string(b) != expected {
+		t.Fatalf("Prepend existing key: %s not equal to expected %s", b, expected)
+	}
+
+	// the moved key behaves as usual afterwards
+	om.Delete("c")
+	om.Set("c", 3)
+	expected := NewOrderedMapFromKVPairs([]*KVPair{{"z", 0}, {"a", 1}, {"b", 2}, {"c", 3}})
+	if !reflect.DeepEqual(om, expected) {
+		t.Fatalf("Prepend: %#v not deeply equal to expected %#v", om, expected)
+	}
+}
+
+func TestValueEquals(t *testing.T) {
+	om := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"n": 3, "f": 2.5, "s": "x", "null": null}`), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	tests := []struct {
+		key      string
+		expected interface{}
+		equal    bool
+	}{
+		{"n", 3, true},
+		{"n", float64(3), true},
+		{"n", uint8(3), true},
+		{"n", json.Number("3.0"), true},
+		{"f", 2.5, true},
+		{"s", "x", true},
+		{"null", nil, true},
+		{"n", 4, false},
+		{"n", "3", false},
+		{"s", "y", false},
+		{"missing", nil, false},
+	}
+	for _, test := range tests {
+		if equal := om.ValueEquals(test.key, test.expected); equal != test.equal {
+			t.Fatalf("ValueEquals %s %#v: got %v", test.key, test.expected, equal)
+		}
+	}
+}
+
+func TestHasAllHasAny(t *testing.T) {
+	om := NewOrderedMapFromKVPairs([]*KVPair{{"a", 1}, {"b", nil}, {"c", 3}})
+
+	for _, tt := range []struct {
+		keys []string
+		all  bool
+		any  bool
+	}{
+		{[]string{"a", "b", "c"}, true, true},
+		{[]string{"a", "x"}, false, true},
+		{[]string{"x", "y"}, false, false},
+		{nil, true, false},
+	} {
+		if all := om.HasAll(tt.keys...); all != tt.all {
+			t.Fatalf("HasAll %q: expect %v but got %v", tt.keys, tt.all, all)
+		}
+		if any := om.HasAny(tt.keys...); any != tt.any {
+			t.Fatalf("HasAny %q: expect %v but got %v", tt.keys, tt.any, any)
+		}
+	}
+}
+
+func TestGetOrderedMapSlice(t *testing.T) {
+	om := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"items": [{"b": 1, "a": 2}, {"c": 3}], "mixed": [{"a": 1}, 2], "empty": []}`), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+
+	items, ok := om.GetOrderedMapSlice("items")
+	if !ok || len(items) != 2 {
+		t.Fatalf("GetOrderedMapSlice items: %#v %v", items, ok)
+	}
+	b, err := json.Marshal(items)
+	if err != nil {
+		t.Fatalf("Marshal []*OrderedMap: %v", err)
+	}
+	if expected := `[{"b":1,"a":2},{"c":3}]`; string(b) != expected {
+		t.Fatalf("GetOrderedMapSlice items: %s not equal to expected %s", b, expected)
+	}
+	if items[0] != om.Get("items").([]interface{})[0] {
+		t.Fatal("GetOrderedMapSlice items: expect the same nested OrderedMap, not a copy")
+	}
+
+	if mixed, ok := om.GetOrderedMapSlice("mixed"); ok {
+		t.Fatalf("GetOrderedMapSlice mixed: expect not ok but got %#v", mixed)
+	}
+	if empty, ok := om.GetOrderedMapSlice("empty"); !ok || len(empty) != 0 {
+		t.Fatalf("GetOrderedMapSlice empty: expect an empty slice but got %#v %v", empty, ok)
+	}
+	if missing, ok := om.GetOrderedMapSlice("missing"); ok || missing != nil {
+		t.Fatalf("GetOrderedMapSlice missing: expect nil and not ok but got %#v %v", missing, ok)
+	}
+}
+
+func TestGetOrderedMap(t *testing.T) {
+	om := NewOrderedMap()
+	data := []byte(`{"raw": {"z": 1, "a": {"y": 2}}, "parsed": {"z": 1, "a": 2}, "arr": [1], "s": "x"}`)
+	if err := om.UnmarshalWithOptions(data, DecodeOptions{MaxDecodeDepth: 1}); err != nil {
+		t.Fatalf("UnmarshalWithOptions: %v", err)
+	}
+	om.Set("parsed", NewOrderedMapFromKVPairs([]*KVPair{{"z", 1}, {"a", 2}}))
+	if _, ok := om.Get("raw").(json.RawMessage); !ok {
+		t.Fatalf("GetOrderedMap: expect a json.RawMessage value, got %T", om.Get("raw"))
+	}
+
+	raw, ok := om.GetOrderedMap("raw")
+	if !ok {
+		t.Fatal("GetOrderedMap: json.RawMessage value should be decoded")
+	}
+	if b, _ := json.Marshal(raw); string(b) != `{"z":1,"a":{"y":2}}` {
+		t.Fatalf("GetOrderedMap: got %s", b)
+	}
+	if cached, _ := om.Get("raw").(*OrderedMap); cached != raw {
+		t.Fatalf("GetOrderedMap: decoded value should be stored back, got %T", om.Get("raw"))
+	}
+	if !reflect.DeepEqual(om.Keys(), []string{"raw", "parsed", "arr", "s"}) {
+		t.Fatalf("GetOrderedMap: keys order changed: %v", om.Keys())
+	}
+
+	parsed, ok := om.GetOrderedMap("parsed")
+	if !ok || !reflect.DeepEqual(parsed.Keys(), []string{"z", "a"}) {
+		t.Fatalf("GetOrderedMap: %#v %v", parsed, ok)
+	}
+
+	for _, key := range []string{"arr", "s", "missing"} {
+		if v, ok := om.GetOrderedMap(key); ok || v != nil {
+			t.Fatalf("GetOrderedMap %s: expect not ok, got %#v", key, v)
+		}
+	}
+	om.Set("rawarr", json.RawMessage(`[1, 2]`))
+	if _, ok := om.GetOrderedMap("rawarr"); ok {
+		t.Fatal("GetOrderedMap: json.RawMessage array should not be ok")
+	}
+}
+
+func TestGetRawMessage(t *testing.T) {
+	om := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"n": 1.50, "s": "x<y", "obj": {"z": 1, "a": [{"y": 2, "b": 3}]}}`), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+
+	for key, expected := range map[string]string{
+		"n":   `1.50`,
+		"s":   `"x\u003cy"`,
+		"obj": `{"z":1,"a":[{"y":2,"b":3}]}`,
+	} {
+		raw, ok := om.GetRawMessage(key)
+		if !ok || string(raw) != expected {
+			t.Fatalf("GetRawMessage %q: %s %v, expected %s", key, raw, ok, expected)
+		}
+	}
+
+	if raw, ok := om.GetRawMessage("missing"); ok || raw != nil {
+		t.Fatalf("GetRawMessage missing: expect nil and not ok but got %s %v", raw, ok)
+	}
+}
+
+func TestGetTypedSlice(t *testing.T) {
+	type server struct {
+		Host string   `json:"host"`
+		Port int      `json:"port"`
+		Tags []string `json:"tags"`
+	}
+	om := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"servers": [{"host": "a", "port": 1, "tags": ["x"]}, {"port": 2, "host": "b"}],
+		"name": "x", "bad": [{"port": "not a number"}]}`), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+
+	servers, ok := GetTypedSlice[server](om, "servers")
+	expected := []server{{"a", 1, []string{"x"}}, {"b", 2, nil}}
+	if !ok || !reflect.DeepEqual(servers, expected) {
+		t.Fatalf("GetTypedSlice servers: %#v %v", servers, ok)
+	}
+
+	if names, ok := GetTypedSlice[string](om, "name"); ok {
+		t.Fatalf("GetTypedSlice name: expect not ok for a non-array value but got %#v", names)
+	}
+	if bad, ok := GetTypedSlice[server](om, "bad"); ok {
+		t.Fatalf("GetTypedSlice bad: expect not ok for a mismatched element but got %#v", bad)
+	}
+	if missing, ok := GetTypedSlice[server](om, "missing"); ok || missing != nil {
+		t.Fatalf("GetTypedSlice missing: %#v %v", missing, ok)
+	}
+}
+
+func TestProcess(t *testing.T) {
+	om := NewOrderedMapFromKVPairs([]*KVPair{{"a", 1}, {"b", 2}, {"c", 3}})
+
+	var visited []string
+	err := om.Process(func(key string, value interface{}) error {
+		visited = append(visited, fmt.Sprintf("%s=%v", key, value))
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(visited, []string{"a=1", "b=2", "c=3"}) {
+		t.Fatalf("Process: %q %v", visited, err)
+	}
+
+	visited = nil
+	failure := fmt.Errorf("failed at b")
+	err = om.Process(func(key string, value interface{}) error {
+		visited = append(visited, key)
+		if key == "b" {
+			return failure
+		}
+		return nil
+	})
+	if err != failure {
+		t.Fatalf("Process: expect the error of fn but got %v", err)
+	}
+	if !reflect.DeepEqual(visited, []string{"a", "b"}) {
+		t.Fatalf("Process: expect to stop after b but visited %q", visited)
+	}
+}
+
+func TestReorderByPriority(t *testing.T) {
+	om := NewOrderedMapFromKVPairs([]*KVPair{
+		{"zeta", 1}, {"name", 2}, {"beta", 3}, {"id", 4}, {"alpha", 5},
+	})
+	om.ReorderByPriority([]string{"id", "missing", "name", "id"})
+
+	b, err := json.Marshal(om)
+	if err != nil {
+		t.Fatalf("Marshal OrderedMap: %v", err)
+	}
+	if expected := `{"id":4,"name":2,"alpha":5,"beta":3,"zeta":1}`; string(b) != expected {
+		t.Fatalf("ReorderByPriority: %s not equal to expected %s", b, expected)
+	}
+
+	om.ReorderByPriority(nil)
+	b, err = json.Marshal(om)
+	if err != nil {
+		t.Fatalf("Marshal OrderedMap: %v", err)
+	}
+	if expected := `{"alpha":5,"beta":3,"id":4,"name":2,"zeta":1}`; string(b) != expected {
+		t.Fatalf("ReorderByPriority no priority: %s not equal to expected %s", b, expected)
+	}
+}
+
+func TestKeysLen(t *testing.T) {
+	om := NewOrderedMapFromKVPairs([]*KVPair{{"b", 1}, {"a", 2}, {"c", 3}})
+	om.Delete("a")
+	om.Set("a", 4)
+	if keys := om.Keys(); !reflect.DeepEqual(keys, []string{"b", "c", "a"}) {
+		t.Fatalf("Keys: %q", keys)
+	}
+	if n := om.Len(); n != 3 {
+		t.Fatalf("Len: expect 3 but got %d", n)
+	}
+	if keys := NewOrderedMap().Keys(); keys == nil || len(keys) != 0 {
+		t.Fatalf("Keys of empty map: %#v", keys)
+	}
+}
+
+// a fake Map recording the calls
+type mockMap struct {
+	Map
+	calls []string
+}
+
+func (mm *mockMap) Get(key string) interface{} {
+	mm.calls = append(mm.calls, "Get "+key)
+	return "mocked"
+}
+
+func (mm *mockMap) Set(key string, value interface{}) {
+	mm.calls = append(mm.calls, fmt.Sprintf("Set %s=%v", key, value))
+}
+
+// a caller depending on the interface only
+func renameKey(m Map, from, to string) {
+	m.Set(to, m.Get(from))
+}
+
+func TestMapInterface(t *testing.T) {
+	mm := &mockMap{}
+	renameKey(mm, "old", "new")
+	if expected := []string{"Get old", "Set new=mocked"}; !reflect.DeepEqual(mm.calls, expected) {
+		t.Fatalf("mock Map calls: %q not equal to expected %q", mm.calls, expected)
+	}
+
+	om := NewOrderedMapFromKVPairs([]*KVPair{{"old", 1}})
+	renameKey(om, "old", "new")
+	if v := om.Get("new"); v != 1 {
+		t.Fatalf("OrderedMap as Map: %v", v)
+	}
+}
+
+func TestValueType(t *testing.T) {
+	om := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"s": "x", "n": 1.5, "b": false, "z": null, "o": {}, "a": []}`), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	om.Set("int", 3)
+	om.Set("float", 0.5)
+	om.Set("std", map[string]interface{}{})
+	om.Set("ints", []int{1})
+	om.Set("bytes", []byte("x"))
+	om.Set("raw", json.RawMessage(` {"a": 1}`))
+	om.Set("struct", struct{}{})
+	om.Set("nilmap", (*OrderedMap)(nil))
+
+	for key, expected := range map[string]string{
+		"s": "string", "n": "number", "b": "bool", "z": "null", "o": "object", "a": "array",
+		"int": "number", "float": "number", "std": "object", "ints": "array", "bytes": "string",
+		"raw": "object", "struct": "object", "nilmap": "null",
+	} {
+		typ, ok := om.ValueType(key)
+		if !ok || typ != expected {
+			t.Fatalf("ValueType %q: expect %q but got %q %v", key, expected, typ, ok)
+		}
+	}
+	if typ, ok := om.ValueType("missing"); ok || typ != "" {
+		t.Fatalf("ValueType missing: %q %v", typ, ok)
+	}
+}
+
+func TestDeleteMany(t *testing.T) {
+	om := NewOrderedMapFromKVPairs([]*KVPair{{"a", 1}, {"b", 2}, {"c", 3}, {"d", 4}, {"e", 5}})
+	om.SetComment("b", "deleted")
+	om.DeleteMany("d", "b", "missing", "b")
+	expected := NewOrderedMapFromKVPairs([]*KVPair{{"a", 1}, {"c", 3}, {"e", 5}})
+	if !reflect.DeepEqual(om.Keys(), expected.Keys()) || !reflect.DeepEqual(om.m, expected.m) {
+		t.Fatalf("DeleteMany: %#v not deeply equal to expected %#v", om, expected)
+	}
+	if om.Comment("b") != "" {
+		t.Fatal("DeleteMany: comment of deleted key should be removed")
+	}
+	om.DeleteMany()
+	if om.Len() != 3 {
+		t.Fatalf("DeleteMany: no keys should delete nothing, got %d keys", om.Len())
+	}
+}
+
+func deleteManyKeys(n int) []string {
+	keys := make([]string, 0, n/2)
+	for i := 0; i < n; i += 2 {
+		keys = append(keys, fmt.Sprintf("key%d", i))
+	}
+	return keys
+}
+
+func BenchmarkDeleteMany(b *testing.B) {
+	keys := deleteManyKeys(10000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		om := newScalarMap(10000)
+		b.StartTimer()
+		om.DeleteMany(keys...)
+	}
+}
+
+// the time per key of deleting every key at growing sizes, reported as ns/key; Delete does O(1) work
+// per key, yet the time per key measured still grows with the size, such as from the CPU cache misses
+// of the larger maps
+func BenchmarkDeleteAll(b *testing.B) {
+	for _, n := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			keys := newScalarMap(n).Keys()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				om := newScalarMap(n)
+				b.StartTimer()
+				for _, key := range keys {
+					om.Delete(key)
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*n), "ns/key")
+		})
+	}
+}
+
+func TestEnumerate(t *testing.T) {
+	om := NewOrderedMapFromKVPairs([]*KVPair{{"c", 1}, {"a", 2}, {"b", 3}})
+	var got []KVPair
+	next := 0
+	for i, kv := range om.Enumerate() {
+		if i != next {
+			t.Fatalf("Enumerate: index %d, expected %d", i, next)
+		}
+		next++
+		got = append(got, kv)
+	}
+	expected := []KVPair{{"c", 1}, {"a", 2}, {"b", 3}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Enumerate: %v not deeply equal to expected %v", got, expected)
+	}
+
+	calls := 0
+	for i := range om.Enumerate() {
+		calls++
+		if i == 1 {
+			break
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("Enumerate: break should stop the iteration, got %d calls", calls)
+	}
+
+	for range NewOrderedMap().Enumerate() {
+		t.Fatal("Enumerate: empty map should yield nothing")
+	}
+}
+
+func TestFind(t *testing.T) {
+	om := NewOrderedMapFromKVPairs([]*KVPair{{"a", 1}, {"b", "two"}, {"c", 3}, {"d", "four"}})
+	isString := func(key string, value interface{}) bool {
+		_, ok := value.(string)
+		return ok
+	}
+	if key, value, ok := om.Find(isString); !ok || key != "b" || value != "two" {
+		t.Fatalf("Find: %q %v %v", key, value, ok)
+	}
+	if key, value, ok := om.Find(func(key string, value interface{}) bool { return value == 1 }); !ok || key != "a" || value != 1 {
+		t.Fatalf("Find first: %q %v %v", key, value, ok)
+	}
+	if key, value, ok := om.Find(func(key string, value interface{}) bool { return key == "z" }); ok || key != "" || value != nil {
+		t.Fatalf("Find no match: %q %v %v", key, value, ok)
+	}
+}
+
+func TestPluck(t *testing.T) {
+	om := NewOrderedMap()
+	data := `{"users": [{"id": 1, "name": "a"}, {"id": 2}, {"name": "c", "id": 3}], "mixed": [{"id": 1}, 2], "s": "x"}`
+	if err := json.Unmarshal([]byte(data), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	ids, ok := om.Pluck("users", "id")
+	if expected := []interface{}{json.Number("1"), json.Number("2"), json.Number("3")}; !ok || !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("Pluck: %v %v", ids, ok)
+	}
+	names, ok := om.Pluck("users", "name")
+	if expected := []interface{}{"a", nil, "c"}; !ok || !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Pluck missing field: %v %v", names, ok)
+	}
+	for _, key := range []string{"mixed", "s", "missing"} {
+		if values, ok := om.Pluck(key, "id"); ok || values != nil {
+			t.Fatalf("Pluck %s: expect not ok, got %v", key, values)
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	newMap := func(data string) *OrderedMap {
+		om := NewOrderedMap()
+		if err := json.Unmarshal([]byte(data), om); err != nil {
+			t.Fatalf("Unmarshal OrderedMap: %v", err)
+		}
+		return om
+	}
+	om := newMap(`{"a": 1, "b": {"c": [1, {"d": null}], "e": "x"}}`)
+	if !om.Equal(newMap(`{"a": 1, "b": {"c": [1, {"d": null}], "e": "x"}}`)) {
+		t.Fatal("Equal: same content should be equal")
+	}
+	if !om.Equal(om.Clone()) {
+		t.Fatal("Equal: clone should be equal")
+	}
+	for _, data := range []string{
+		`{"b": {"c": [1, {"d": null}], "e": "x"}, "a": 1}`,
+		`{"a": 1, "b": {"e": "x", "c": [1, {"d": null}]}}`,
+		`{"a": 1, "b": {"c": [1, {"d": 0}], "e": "x"}}`,
+		`{"a": 1, "b": {"c": [1], "e": "x"}}`,
+		`{"a": 1.0, "b": {"c": [1, {"d": null}], "e": "x"}}`,
+		`{"a": 1}`,
+	} {
+		if om.Equal(newMap(data)) {
+			t.Fatalf("Equal: %s should not be equal", data)
+		}
+	}
+	if om.Equal(nil) || !(*OrderedMap)(nil).Equal(nil) {
+		t.Fatal("Equal: nil map should only equal nil")
+	}
+}
+
+func TestCommonKeyPrefix(t *testing.T) {
+	for _, c := range []struct {
+		keys     []string
+		expected string
+	}{
+		{[]string{"app.db.host", "app.db.port", "app.db.tls.cert"}, "app.db"},
+		{[]string{"app.db.host", "app.dbx"}, "app"},
+		{[]string{"app.db", "app.db.host"}, "app.db"},
+		{[]string{"app.db.host", "web.port"}, ""},
+		{[]string{"app.db.host"}, "app.db.host"},
+		{nil, ""},
+	} {
+		om := NewOrderedMap()
+		for _, key := range c.keys {
+			om.Set(key, 1)
+		}
+		if prefix := om.CommonKeyPrefix("."); prefix != c.expected {
+			t.Fatalf("CommonKeyPrefix %v: got %q, expected %q", c.keys, prefix, c.expected)
+		}
+	}
+	om := NewOrderedMapFromKVPairs([]*KVPair{{"a/b/c", 1}, {"a/b/d", 2}})
+	if prefix := om.CommonKeyPrefix("/"); prefix != "a/b" {
+		t.Fatalf("CommonKeyPrefix: got %q", prefix)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	om := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"c": 1, "a": "x", "b": 2.5, "d": [3]}`), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	var visited []string
+	om.Update(func(key string, value interface{}) (interface{}, bool) {
+		visited = append(visited, key)
+		num, ok := value.(json.Number)
+		if !ok {
+			return nil, false
+		}
+		f, _ := num.Float64()
+		return f * 2, true
+	})
+	expected := NewOrderedMapFromKVPairs([]*KVPair{{"c", float64(2)}, {"a", "x"}, {"b", float64(5)}, {"d", []interface{}{json.Number("3")}}})
+	if !reflect.DeepEqual(om, expected) {
+		t.Fatalf("Update: %#v not deeply equal to expected %#v", om, expected)
+	}
+	if !reflect.DeepEqual(visited, []string{"c", "a", "b", "d"}) {
+		t.Fatalf("Update: visited %v", visited)
+	}
+}
+
+func TestInvertScalar(t *testing.T) {
+	om := NewOrderedMap()
+	data := `{"b": "x", "a": 1, "c": "x", "d": {"e": "x"}, "f": ["x"], "g": 1, "h": true, "i": "1"}`
+	if err := json.Unmarshal([]byte(data), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	expected := map[string][]string{
+		"x":    {"b", "c"},
+		"1":    {"a", "g", "i"},
+		"true": {"h"},
+	}
+	if res := om.InvertScalar(); !reflect.DeepEqual(res, expected) {
+		t.Fatalf("InvertScalar: got %v, expected %v", res, expected)
+	}
+	if res := NewOrderedMap().InvertScalar(); len(res) != 0 {
+		t.Fatalf("InvertScalar empty map: got %v", res)
+	}
+}
+
+func TestChunk(t *testing.T) {
+	om := NewOrderedMapFromKVPairs([]*KVPair{{"e", 1}, {"d", 2}, {"c", 3}, {"b", 4}, {"a", 5}, {"z", 6}})
+	chunkKeys := func(chunks []*OrderedMap) [][]string {
+		res := make([][]string, 0, len(chunks))
+		for _, chunk := range chunks {
+			res = append(res, chunk.Keys())
+		}
+		return res
+	}
+
+	tests := []struct {
+		size     int
+		expected [][]string
+	}{
+		{3, [][]string{{"e", "d", "c"}, {"b", "a", "z"}}},
+		{4, [][]string{{"e", "d", "c", "b"}, {"a", "z"}}},
+		{10, [][]string{{"e", "d", "c", "b", "a", "z"}}},
+		{0, [][]string{{"e", "d", "c", "b", "a", "z"}}},
+		{-1, [][]string{{"e", "d", "c", "b", "a", "z"}}},
+	}
+	for _, test := range tests {
+		if keys := chunkKeys(om.Chunk(test.size)); !reflect.DeepEqual(keys, test.expected) {
+			t.Fatalf("Chunk %d: got %v, expected %v", test.size, keys, test.expected)
+		}
+	}
+	if chunks := om.Chunk(4); chunks[1].Get("z") != 6 {
+		t.Fatalf("Chunk: expect the values, got %v", chunks[1])
+	}
+	if chunks := NewOrderedMap().Chunk(2); len(chunks) != 0 {
+		t.Fatalf("Chunk empty map: got %v", chunks)
+	}
+}
+
+func TestPartition(t *testing.T) {
+	om := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"e": "x", "c": 1, "a": "y", "d": [2], "b": "z"}`), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	strs, rest := om.Partition(func(key string, value interface{}) bool {
+		_, ok := value.(string)
+		return ok
+	})
+	if expected := NewOrderedMapFromKVPairs([]*KVPair{{"e", "x"}, {"a", "y"}, {"b", "z"}}); !reflect.DeepEqual(strs, expected) {
+		t.Fatalf("Partition matched: %#v not deeply equal to expected %#v", strs, expected)
+	}
+	if !reflect.DeepEqual(rest.Keys(), []string{"c", "d"}) || rest.Get("c") != json.Number("1") {
+		t.Fatalf("Partition rest: %v", rest.Keys())
+	}
+	if om.Len() != 5 || strs.Len()+rest.Len() != om.Len() {
+		t.Fatalf("Partition: the map should be untouched and split fully, got %d %d %d", om.Len(), strs.Len(), rest.Len())
+	}
+	for _, key := range om.Keys() {
+		if strs.Has(key) == rest.Has(key) {
+			t.Fatalf("Partition: key %q should be in exactly one half", key)
+		}
+	}
+
+	all, none := om.Partition(func(string, interface{}) bool { return true })
+	if !all.Equal(om) || none.Len() != 0 {
+		t.Fatalf("Partition all: %v %v", all.Keys(), none.Keys())
+	}
+}
+
+func TestGetDuration(t *testing.T) {
+	om := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"timeout": "30s", "retry": "1h5m", "bad": "5 minutes", "n": 30}`), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	if d, ok := om.GetDuration("timeout"); !ok || d != 30*time.Second {
+		t.Fatalf("GetDuration: %v %v", d, ok)
+	}
+	if d, ok := om.GetDuration("retry"); !ok || d != time.Hour+5*time.Minute {
+		t.Fatalf("GetDuration: %v %v", d, ok)
+	}
+	for _, key := range []string{"bad", "n", "missing"} {
+		if d, ok := om.GetDuration(key); ok || d != 0 {
+			t.Fatalf("GetDuration %s: expect not ok, got %v", key, d)
+		}
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	om := NewOrderedMap()
+	data := `{"displayName": "", "nickname": null, "tags": [], "profile": {}, "zero": 0, "off": false, "name": "x", "login": "y"}`
+	if err := json.Unmarshal([]byte(data), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	if value, key, ok := om.Coalesce("login", "name"); !ok || key != "login" || value != "y" {
+		t.Fatalf("Coalesce first: %v %q %v", value, key, ok)
+	}
+	if value, key, ok := om.Coalesce("displayName", "missing", "nickname", "tags", "profile", "off", "name", "login"); !ok || key != "name" || value != "x" {
+		t.Fatalf("Coalesce after empties: %v %q %v", value, key, ok)
+	}
+	// a json.Number is empty only when "", same as omitempty
+	if value, key, ok := om.Coalesce("displayName", "zero"); !ok || key != "zero" || value != json.Number("0") {
+		t.Fatalf("Coalesce json.Number: %v %q %v", value, key, ok)
+	}
+	om.Set("int", 0)
+	if value, key, ok := om.Coalesce("displayName", "nickname", "tags", "profile", "off", "int", "missing"); ok || key != "" || value != nil {
+		t.Fatalf("Coalesce all empty: %v %q %v", value, key, ok)
+	}
+	if _, _, ok := om.Coalesce(); ok {
+		t.Fatal("Coalesce no keys: expect not ok")
+	}
+}
+
+func TestNewKeysSince(t *testing.T) {
+	om := NewOrderedMapFromKVPairs([]*KVPair{{"a", 1}, {"b", 2}})
+	snapshot := om.Keys()
+	if keys := om.NewKeysSince(snapshot); len(keys) != 0 {
+		t.Fatalf("NewKeysSince no change: %v", keys)
+	}
+	om.Set("d", 4)
+	om.Prepend("c", 3)
+	om.Set("a", "changed")
+	om.Delete("b")
+	if keys := om.NewKeysSince(snapshot); !reflect.DeepEqual(keys, []string{"c", "d"}) {
+		t.Fatalf("NewKeysSince: got %v", keys)
+	}
+	if keys := om.NewKeysSince(nil); !reflect.DeepEqual(keys, om.Keys()) {
+		t.Fatalf("NewKeysSince empty snapshot: got %v", keys)
+	}
+}
+
+func TestIsSubsetOf(t *testing.T) {
+	newMap := func(data string) *OrderedMap {
+		om := NewOrderedMap()
+		if err := json.Unmarshal([]byte(data), om); err != nil {
+			t.Fatalf("Unmarshal OrderedMap: %v", err)
+		}
+		return om
+	}
+	other := newMap(`{"a": 1, "b": {"c": "x", "d": [1, {"e": true, "f": 2}]}, "g": null}`)
+	for _, data := range []string{
+		`{}`,
+		`{"a": 1}`,
+		`{"b": {"d": [1, {"e": true}]}, "a": 1.0}`,
+		`{"g": null, "b": {}}`,
+		`{"a": 1, "b": {"c": "x", "d": [1, {"e": true, "f": 2}]}, "g": null}`,
+	} {
+		if !newMap(data).IsSubsetOf(other) {
+			t.Fatalf("IsSubsetOf %s: expect true", data)
+		}
+	}
+	for _, data := range []string{
+		`{"z": 1}`,
+		`{"a": 2}`,
+		`{"a": "1"}`,
+		`{"b": {"c": "y"}}`,
+		`{"b": {"d": [1]}}`,
+		`{"b": 1}`,
+		`{"a": 1, "b": {"c": "x", "d": [1, {"e": true, "f": 2}]}, "g": null, "h": 0}`,
+	} {
+		if newMap(data).IsSubsetOf(other) {
+			t.Fatalf("IsSubsetOf %s: expect false", data)
+		}
+	}
+	om := NewOrderedMapFromKVPairs([]*KVPair{{"a", 1}})
+	if !om.IsSubsetOf(other) || om.IsSubsetOf(nil) {
+		t.Fatal("IsSubsetOf: expect an int equal to a json.Number and nothing a subset of nil")
+	}
+}
+
+func TestSortArrayBy(t *testing.T) {
+	om := NewOrderedMap()
+	data := `{"items": [{"id": 3, "name": "c"}, {"id": 1, "name": "b"}, {"id": 2, "name": "b2"}], "n": 1, "mixed": [{"id": 1}, 2]}`
+	if err := json.Unmarshal([]byte(data), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+
+	byNumber := func(a, b interface{}) bool {
+		x, _ := a.(json.Number).Float64()
+		y, _ := b.(json.Number).Float64()
+		return x < y
+	}
+	if err := om.SortArrayBy("items", "id", byNumber); err != nil {
+		t.Fatalf("SortArrayBy: %v", err)
+	}
+	b, _ := json.Marshal(om.Get("items"))
+	if expected := `[{"id":1,"name":"b"},{"id":2,"name":"b2"},{"id":3,"name":"c"}]`; string(b) != expected {
+		t.Fatalf("SortArrayBy numeric field: got %s, expected %s", b, expected)
+	}
+
+	byString := func(a, b interface{}) bool {
+		x, _ := a.(string)
+		y, _ := b.(string)
+		return x > y
+	}
+	if err := om.SortArrayBy("items", "name", byString); err != nil {
+		t.Fatalf("SortArrayBy: %v", err)
+	}
+	b, _ = json.Marshal(om.Get("items"))
+	if expected := `[{"id":3,"name":"c"},{"id":2,"name":"b2"},{"id":1,"name":"b"}]`; string(b) != expected {
+		t.Fatalf("SortArrayBy string field: got %s, expected %s", b, expected)
+	}
+
+	for _, key := range []string{"missing", "n", "mixed"} {
+		if err := om.SortArrayBy(key, "id", byNumber); err == nil {
+			t.Fatalf("SortArrayBy %s: expect an error", key)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package ordered
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// a step of a JSONPath expression, either the child key of an object, with isIndex the index of an array,
+// or with wildcard every child of an object or every element of an array
+type selector struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// return the values matching a JSONPath expression, such as "$.a.b[0].c", in the order of the document;
+// only a subset is supported for now: the root "$", the child key ".key" or "['key']" (quoted
+// without escapes), the array index "[0]" and the wildcard ".*" or "[*]" selecting every child of an
+// object or every element of an array. An error is returned for anything else, such as the recursive
+// descent or the filters, and an expression matching nothing returns no values
+func (om *OrderedMap) Query(expr string) ([]interface{}, error) {
+	selectors, err := parseQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	res := []interface{}{om}
+	for _, s := range selectors {
+		next := make([]interface{}, 0, len(res))
+		for _, v := range res {
+			next = s.apply(v, next)
+		}
+		res = next
+	}
+	return res, nil
+}
+
+// append the values of v selected to res
+func (s selector) apply(v interface{}, res []interface{}) []interface{} {
+	switch v := v.(type) {
+	case *OrderedMap:
+		if v == nil || s.isIndex {
+			break
+		}
+		if s.wildcard {
+			for e := v.l.Front(); e != nil; e = e.Next() {
+				res = append(res, v.m[e.Value.(string)])
+			}
+		} else if child, ok := v.m[s.key]; ok {
+			res = append(res, child)
+		}
+	case []interface{}:
+		if s.wildcard {
+			res = append(res, v...)
+		} else if s.isIndex && s.index < len(v) {
+			res = append(res, v[s.index])
+		}
+	case []*OrderedMap:
+		if s.wildcard {
+			for _, elem := range v {
+				res = append(res, elem)
+			}
+		} else if s.isIndex && s.index < len(v) {
+			res = append(res, v[s.index])
+		}
+	}
+	return res
+}
+
+func parseQuery(expr string) ([]selector, error) {
+	invalid := func(offset int, msg string) error {
+		return fmt.Errorf("invalid JSONPath %q at offset %d: %s", expr, offset, msg)
+	}
+	if !strings.HasPrefix(expr, "$") {
+		return nil, invalid(0, `expect the root "$"`)
+	}
+	var selectors []selector
+	for i := 1; i < len(expr); {
+		switch expr[i] {
+		case '.':
+			j := i + 1
+			for j < len(expr) && expr[j] != '.' && expr[j] != '[' {
+				j++
+			}
+			switch key := expr[i+1 : j]; key {
+			case "":
+				return nil, invalid(i, "expect a key after '.', the recursive descent is not supported")
+			case "*":
+				selectors = append(selectors, selector{wildcard: true})
+			default:
+				selectors = append(selectors, selector{key: key})
+			}
+			i = j
+		case '[':
+			end := strings.IndexByte(expr[i:], ']')
+			if end < 0 {
+				return nil, invalid(i, "unclosed '['")
+			}
+			inner := expr[i+1 : i+end]
+			if inner == "*" {
+				selectors = append(selectors, selector{wildcard: true})
+			} else if n := len(inner); n >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[n-1] == inner[0] {
+				selectors = append(selectors, selector{key: inner[1 : n-1]})
+			} else if index, err := strconv.Atoi(inner); err == nil && index >= 0 && inner[0] != '+' {
+				selectors = append(selectors, selector{index: index, isIndex: true})
+			} else {
+				return nil, invalid(i, fmt.Sprintf("unsupported selector [%s]", inner))
+			}
+			i += end + 1
+		default:
+			return nil, invalid(i, fmt.Sprintf("unexpected %q", expr[i]))
+		}
+	}
+	return selectors, nil
+}
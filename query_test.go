@@ -0,0 +1,84 @@
+package ordered
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	om := NewOrderedMap()
+	data := `{"a": {"b": [{"c": 1}, {"c": "two", "d.e": true}]}, "list": [[1, 2], [3]]}`
+	if err := json.Unmarshal([]byte(data), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+
+	tests := []struct {
+		expr     string
+		expected []interface{}
+	}{
+		{"$", []interface{}{om}},
+		{"$.a.b[1].c", []interface{}{"two"}},
+		{"$.a.b[0].c", []interface{}{json.Number("1")}},
+		{"$['a'].b[1][\"d.e\"]", []interface{}{true}},
+		{"$.list[0][1]", []interface{}{json.Number("2")}},
+		{"$.list[1][1]", []interface{}{}},
+		{"$.a.missing.c", []interface{}{}},
+		{"$.a[0]", []interface{}{}},
+	}
+	for _, test := range tests {
+		res, err := om.Query(test.expr)
+		if err != nil {
+			t.Fatalf("Query %s: %v", test.expr, err)
+		}
+		if !reflect.DeepEqual(res, test.expected) {
+			t.Fatalf("Query %s: got %v, expected %v", test.expr, res, test.expected)
+		}
+	}
+
+	for _, expr := range []string{"", "a.b", "$..c", "$.a.b[-1]", "$.a.b[0", "$.a.b[?(@.c)]", "$a"} {
+		if _, err := om.Query(expr); err == nil {
+			t.Fatalf("Query %q: expect an error", expr)
+		}
+	}
+}
+
+func TestQueryWildcard(t *testing.T) {
+	om := NewOrderedMap()
+	data := `{"b": 1, "a": "x", "items": [{"name": "n1", "id": 1}, {"id": 2}, {"name": "n3"}, "scalar"]}`
+	if err := json.Unmarshal([]byte(data), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+
+	res, err := om.Query("$.*")
+	if err != nil {
+		t.Fatalf("Query $.*: %v", err)
+	}
+	if len(res) != 3 || res[0] != json.Number("1") || res[1] != "x" {
+		t.Fatalf("Query $.*: got %v", res)
+	}
+
+	res, err = om.Query("$.items[*]")
+	if err != nil {
+		t.Fatalf("Query $.items[*]: %v", err)
+	}
+	if len(res) != 4 || res[3] != "scalar" {
+		t.Fatalf("Query $.items[*]: got %v", res)
+	}
+
+	res, err = om.Query("$.items[*].name")
+	if err != nil {
+		t.Fatalf("Query $.items[*].name: %v", err)
+	}
+	if expected := []interface{}{"n1", "n3"}; !reflect.DeepEqual(res, expected) {
+		t.Fatalf("Query $.items[*].name: got %v, expected %v", res, expected)
+	}
+
+	res, err = om.Query("$['items'].*.id")
+	if err != nil {
+		t.Fatalf("Query $['items'].*.id: %v", err)
+	}
+	if expected := []interface{}{json.Number("1"), json.Number("2")}; !reflect.DeepEqual(res, expected) {
+		t.Fatalf("Query $['items'].*.id: got %v, expected %v", res, expected)
+	}
+}
@@ -0,0 +1,75 @@
+package ordered
+
+import (
+	"fmt"
+)
+
+// group the items by the value of key, keys of the result are the distinct values in the order
+// first seen (non-string values formatted by fmt.Sprint), values are the []*OrderedMap of the matching
+// items in their original order; items missing the key are grouped under the empty key ""
+func GroupBy(items []*OrderedMap, key string) *OrderedMap {
+	res := NewOrderedMap()
+	for _, item := range items {
+		group := ""
+		if value, ok := item.m[key]; ok {
+			group = toString(value)
+		}
+		elems, _ := res.m[group].([]*OrderedMap)
+		res.Set(group, append(elems, item))
+	}
+	return res
+}
+
+// index the items by the value of key (non-string values formatted by fmt.Sprint, same as GroupBy),
+// for looking up an item by its id; items missing the key are skipped, and for items sharing a value
+// the last one wins
+func BuildIndex(items []*OrderedMap, key string) map[string]*OrderedMap {
+	res := make(map[string]*OrderedMap, len(items))
+	for _, item := range items {
+		if value, ok := item.m[key]; ok {
+			res[toString(value)] = item
+		}
+	}
+	return res
+}
+
+// return every distinct key of the maps, in the order first seen across the maps in turn, such as the
+// columns of a union schema for heterogeneous records; nil maps are skipped
+func UnionKeys(maps ...*OrderedMap) []string {
+	seen := make(map[string]bool)
+	keys := make([]string, 0)
+	for _, om := range maps {
+		if om == nil {
+			continue
+		}
+		for e := om.l.Front(); e != nil; e = e.Next() {
+			if key := e.Value.(string); !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// return a new map with exactly the keys of template in its order, such as for uniform records: the
+// values of the map are kept, missing keys get fillMissing and the keys not in template are dropped;
+// the values are not copied, so nested objects are shared with the map
+func (om *OrderedMap) Conform(template []string, fillMissing interface{}) *OrderedMap {
+	res := NewOrderedMap()
+	for _, key := range template {
+		if value, ok := om.m[key]; ok {
+			res.Set(key, value)
+		} else {
+			res.Set(key, fillMissing)
+		}
+	}
+	return res
+}
+
+func toString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,130 @@
+package ordered
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func decodeItems(t *testing.T, data string) []*OrderedMap {
+	om := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"items": `+data+`}`), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	items, ok := om.GetOrderedMapSlice("items")
+	if !ok {
+		t.Fatalf("expect an array of objects: %s", data)
+	}
+	return items
+}
+
+func TestGroupBy(t *testing.T) {
+	items := decodeItems(t, `[
+		{"team": "b", "name": "x"},
+		{"team": "a", "name": "y"},
+		{"name": "lonely"},
+		{"team": "b", "name": "z"},
+		{"team": 1, "name": "n"}
+	]`)
+
+	groups := GroupBy(items, "team")
+	b, err := json.Marshal(groups)
+	if err != nil {
+		t.Fatalf("Marshal OrderedMap: %v", err)
+	}
+	const expected = `{"b":[{"team":"b","name":"x"},{"team":"b","name":"z"}],"a":[{"team":"a","name":"y"}],` +
+		`"":[{"name":"lonely"}],"1":[{"team":1,"name":"n"}]}`
+	if string(b) != expected {
+		t.Fatalf("GroupBy:\nhave: %s\nwant: %s", b, expected)
+	}
+	if bs := groups.Get("b").([]*OrderedMap); bs[0] != items[0] || bs[1] != items[3] {
+		t.Fatal("GroupBy: expect the same items, not copies")
+	}
+
+	// the maps of the groups are written with the options, copied and frozen along
+	b, err = groups.MarshalWithOptions(MarshalOptions{SortKeys: true, ExcludeKeys: []string{"team"}})
+	if err != nil {
+		t.Fatalf("MarshalWithOptions: %v", err)
+	}
+	if expected := `{"":[{"name":"lonely"}],"1":[{"name":"n"}],"a":[{"name":"y"}],"b":[{"name":"x"},{"name":"z"}]}`; string(b) != expected {
+		t.Fatalf("GroupBy MarshalWithOptions:\nhave: %s\nwant: %s", b, expected)
+	}
+	clone := groups.Clone()
+	if bs := clone.Get("b").([]*OrderedMap); bs[0] == items[0] || !bs[0].Equal(items[0]) {
+		t.Fatal("GroupBy Clone: expect copies of the items")
+	}
+	groups.Freeze()
+	if !items[0].Frozen() {
+		t.Fatal("GroupBy Freeze: expect the items frozen")
+	}
+
+	if empty := GroupBy(nil, "team"); len(empty.m) != 0 {
+		t.Fatalf("GroupBy no items: %#v", empty)
+	}
+}
+
+func TestBuildIndex(t *testing.T) {
+	items := decodeItems(t, `[
+		{"id": "a", "name": "x"},
+		{"id": 2, "name": "y"},
+		{"name": "no id"},
+		{"id": "a", "name": "z"}
+	]`)
+
+	index := BuildIndex(items, "id")
+	if len(index) != 2 {
+		t.Fatalf("BuildIndex: expect 2 entries, got %v", index)
+	}
+	if index["a"] != items[3] {
+		t.Fatalf("BuildIndex: expect the last item for a duplicate value, got %v", index["a"])
+	}
+	if index["2"] != items[1] {
+		t.Fatalf("BuildIndex: expect the item for a number value, got %v", index["2"])
+	}
+	if _, ok := index[""]; ok {
+		t.Fatal("BuildIndex: items missing the key should be skipped")
+	}
+
+	if empty := BuildIndex(items, "missing"); len(empty) != 0 {
+		t.Fatalf("BuildIndex missing key: %v", empty)
+	}
+}
+
+func TestUnionKeys(t *testing.T) {
+	items := decodeItems(t, `[
+		{"id": 1, "name": "x"},
+		{"name": "y", "age": 3, "id": 2},
+		{"city": "z"}
+	]`)
+
+	keys := UnionKeys(items[0], nil, items[1], items[2])
+	if expected := []string{"id", "name", "age", "city"}; !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("UnionKeys: got %v, expected %v", keys, expected)
+	}
+	if keys = UnionKeys(items[2], items[0]); !reflect.DeepEqual(keys, []string{"city", "id", "name"}) {
+		t.Fatalf("UnionKeys disjoint: got %v", keys)
+	}
+	if keys = UnionKeys(); len(keys) != 0 {
+		t.Fatalf("UnionKeys no maps: got %v", keys)
+	}
+}
+
+func TestConform(t *testing.T) {
+	items := decodeItems(t, `[
+		{"name": "x"},
+		{"extra": true, "age": 3, "name": "y", "id": 2}
+	]`)
+	template := []string{"id", "name", "age"}
+
+	b, _ := json.Marshal(items[0].Conform(template, nil))
+	if expected := `{"id":null,"name":"x","age":null}`; string(b) != expected {
+		t.Fatalf("Conform missing keys: got %s, expected %s", b, expected)
+	}
+	b, _ = json.Marshal(items[1].Conform(template, ""))
+	if expected := `{"id":2,"name":"y","age":3}`; string(b) != expected {
+		t.Fatalf("Conform extra keys: got %s, expected %s", b, expected)
+	}
+	if items[1].Len() != 4 {
+		t.Fatalf("Conform: the map should be left as is, got %v", items[1].Keys())
+	}
+}
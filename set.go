@@ -0,0 +1,91 @@
+package ordered
+
+import (
+	"container/list"
+	"encoding/json"
+	"iter"
+)
+
+// the OrderedSet type, a set of strings keeping the order of insertion, backed by a double linked list
+// and a map like OrderedMap, so Add, Has and Delete runs at O(1); it marshals as a JSON array
+type OrderedSet struct {
+	l     *list.List
+	items map[string]*list.Element
+}
+
+// Create a new OrderedSet
+func NewOrderedSet() *OrderedSet {
+	return &OrderedSet{
+		l:     list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// add the item at the end of the order, an existing item keeps its position; return whether it was added
+func (s *OrderedSet) Add(item string) bool {
+	if _, ok := s.items[item]; ok {
+		return false
+	}
+	s.items[item] = s.l.PushBack(item)
+	return true
+}
+
+// Check if the item exists
+func (s *OrderedSet) Has(item string) bool {
+	_, ok := s.items[item]
+	return ok
+}
+
+// delete the item, return whether it existed
+func (s *OrderedSet) Delete(item string) bool {
+	e, ok := s.items[item]
+	if ok {
+		s.l.Remove(e)
+		delete(s.items, item)
+	}
+	return ok
+}
+
+// return the number of items
+func (s *OrderedSet) Len() int {
+	return len(s.items)
+}
+
+// return all items, in the same order of items added
+func (s *OrderedSet) Values() []string {
+	res := make([]string, 0, s.l.Len())
+	for e := s.l.Front(); e != nil; e = e.Next() {
+		res = append(res, e.Value.(string))
+	}
+	return res
+}
+
+// Iterate all items in the same order of items added, as a range-over-func iterator: for item := range s.All()
+func (s *OrderedSet) All() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for e := s.l.Front(); e != nil; e = e.Next() {
+			if !yield(e.Value.(string)) {
+				return
+			}
+		}
+	}
+}
+
+// marshal the set as a JSON array of the items in the order of items added
+func (s *OrderedSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Values())
+}
+
+// unmarshal a JSON array of strings into the set, replacing its items; duplicates are kept once at their first position
+func (s *OrderedSet) UnmarshalJSON(data []byte) error {
+	var items []string
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+	s.l = list.New()
+	s.items = make(map[string]*list.Element, len(items))
+	for _, item := range items {
+		s.Add(item)
+	}
+	return nil
+}
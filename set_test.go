@@ -0,0 +1,73 @@
+package ordered
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestOrderedSet(t *testing.T) {
+	s := NewOrderedSet()
+	for _, item := range []string{"c", "a", "b"} {
+		if !s.Add(item) {
+			t.Fatalf("Add %q: expect added", item)
+		}
+	}
+	if s.Add("a") {
+		t.Fatal("Add: duplicate should not be added")
+	}
+	if s.Len() != 3 || !s.Has("a") || s.Has("z") {
+		t.Fatalf("OrderedSet: %v", s.Values())
+	}
+	if !reflect.DeepEqual(s.Values(), []string{"c", "a", "b"}) {
+		t.Fatalf("Values: %v", s.Values())
+	}
+
+	if !s.Delete("a") || s.Delete("a") {
+		t.Fatal("Delete: expect true only for an existing item")
+	}
+	s.Add("a")
+	var got []string
+	for item := range s.All() {
+		got = append(got, item)
+	}
+	if !reflect.DeepEqual(got, []string{"c", "b", "a"}) {
+		t.Fatalf("All: %v", got)
+	}
+	for item := range s.All() {
+		if item != "c" {
+			t.Fatalf("All: break should stop the iteration, got %q", item)
+		}
+		break
+	}
+}
+
+func TestOrderedSetJSON(t *testing.T) {
+	s := NewOrderedSet()
+	s.Add("z")
+	s.Add("a")
+	b, err := json.Marshal(s)
+	if err != nil || string(b) != `["z","a"]` {
+		t.Fatalf("MarshalJSON: %s %v", b, err)
+	}
+	if b, err = json.Marshal(NewOrderedSet()); err != nil || string(b) != `[]` {
+		t.Fatalf("MarshalJSON empty: %s %v", b, err)
+	}
+
+	round := NewOrderedSet()
+	round.Add("old")
+	if err := json.Unmarshal([]byte(`["y", "x", "y", "w"]`), round); err != nil {
+		t.Fatalf("UnmarshalJSON: %v", err)
+	}
+	if !reflect.DeepEqual(round.Values(), []string{"y", "x", "w"}) {
+		t.Fatalf("UnmarshalJSON: %v", round.Values())
+	}
+
+	var zero OrderedSet
+	if err := json.Unmarshal([]byte(`["a"]`), &zero); err != nil || !zero.Has("a") {
+		t.Fatalf("UnmarshalJSON zero value: %v", err)
+	}
+	if err := json.Unmarshal([]byte(`["a", 1]`), round); err == nil {
+		t.Fatal("UnmarshalJSON: expecting error for non-string item")
+	}
+}
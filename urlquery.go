@@ -0,0 +1,104 @@
+package ordered
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// render the map as URL query parameters "key=value&key2=value2" in the same order of keys inserted, the
+// keys and values escaped by url.QueryEscape; an array value repeats the key for each element. Scalars
+// are stringified (a null as the empty value), while a nested object, or an array inside an array, has
+// no query form and is skipped, so check the map is flat if that matters
+func (om *OrderedMap) EncodeQuery() string {
+	var b strings.Builder
+	add := func(key string, v interface{}) {
+		if s, ok := queryValue(v); ok {
+			if b.Len() > 0 {
+				b.WriteByte('&')
+			}
+			b.WriteString(url.QueryEscape(key))
+			b.WriteByte('=')
+			b.WriteString(url.QueryEscape(s))
+		}
+	}
+	for e := om.l.Front(); e != nil; e = e.Next() {
+		key := e.Value.(string)
+		switch v := om.m[key].(type) {
+		case []interface{}:
+			for _, elem := range v {
+				add(key, elem)
+			}
+		case MultiValue:
+			for _, elem := range v {
+				add(key, elem)
+			}
+		default:
+			add(key, v)
+		}
+	}
+	return b.String()
+}
+
+// parse URL query parameters, such as "a=1&b=x&a=2" without the leading '?', into a map of their keys in
+// the order first seen; the values are strings, a repeated key collects all its values in order into a
+// []interface{}. Same as url.ParseQuery, '+' is a space and a malformed escape or a ';' is an error
+func DecodeQuery(raw string) (*OrderedMap, error) {
+	om := NewOrderedMap()
+	for _, part := range strings.Split(raw, "&") {
+		if part == "" {
+			continue
+		}
+		if strings.Contains(part, ";") {
+			return nil, fmt.Errorf("invalid semicolon separator in query %q", part)
+		}
+		key, value := part, ""
+		if i := strings.IndexByte(part, '='); i >= 0 {
+			key, value = part[:i], part[i+1:]
+		}
+		key, err := url.QueryUnescape(key)
+		if err != nil {
+			return nil, fmt.Errorf("query key %q: %v", part, err)
+		}
+		if value, err = url.QueryUnescape(value); err != nil {
+			return nil, fmt.Errorf("query value of key %q: %v", key, err)
+		}
+		switch existing := om.m[key].(type) {
+		case nil:
+			om.Set(key, value)
+		case []interface{}:
+			om.Set(key, append(existing, value))
+		default:
+			om.Set(key, []interface{}{existing, value})
+		}
+	}
+	return om, nil
+}
+
+// the query form of a scalar value, false for an object or an array
+func queryValue(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", true
+	case string:
+		return v, true
+	case json.Number:
+		return string(v), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), true
+	case *OrderedMap:
+		return "", false
+	}
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array:
+		return "", false
+	}
+	return fmt.Sprint(v), true
+}
@@ -0,0 +1,53 @@
+package ordered
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEncodeQuery(t *testing.T) {
+	om := NewOrderedMap()
+	data := `{"q": "a b&c", "page": 2, "exact": true, "none": null, "tag": ["x", 1, {"skip": 1}, ["skip"]], "nested": {"skip": 1}, "é": "é"}`
+	if err := json.Unmarshal([]byte(data), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	om.Set("f", 0.5)
+	om.Set("empty", []interface{}{})
+
+	expected := "q=a+b%26c&page=2&exact=true&none=&tag=x&tag=1&%C3%A9=%C3%A9&f=0.5"
+	if query := om.EncodeQuery(); query != expected {
+		t.Fatalf("EncodeQuery: got %s, expected %s", query, expected)
+	}
+
+	om = NewOrderedMapFromKVPairs([]*KVPair{{"z", 1}, {"a", 2}, {"m", 3}})
+	if query := om.EncodeQuery(); query != "z=1&a=2&m=3" {
+		t.Fatalf("EncodeQuery order: got %s", query)
+	}
+	if query := NewOrderedMap().EncodeQuery(); query != "" {
+		t.Fatalf("EncodeQuery empty map: got %s", query)
+	}
+}
+
+func TestDecodeQuery(t *testing.T) {
+	om, err := DecodeQuery("z=1&tag=x&a=b+c%26d&tag=y&flag&empty=&tag=z&&%C3%A9=%C3%A9")
+	if err != nil {
+		t.Fatalf("DecodeQuery: %v", err)
+	}
+	b, _ := json.Marshal(om)
+	if expected := `{"z":"1","tag":["x","y","z"],"a":"b c\u0026d","flag":"","empty":"","é":"é"}`; string(b) != expected {
+		t.Fatalf("DecodeQuery: got %s, expected %s", b, expected)
+	}
+
+	if roundTrip, err := DecodeQuery(om.EncodeQuery()); err != nil || !roundTrip.Equal(om) {
+		t.Fatalf("DecodeQuery of EncodeQuery: got %v, err %v", roundTrip, err)
+	}
+
+	for _, raw := range []string{"a=%zz", "%=1", "a=1;b=2"} {
+		if _, err := DecodeQuery(raw); err == nil {
+			t.Fatalf("DecodeQuery %q: expect an error", raw)
+		}
+	}
+	if om, err = DecodeQuery(""); err != nil || om.Len() != 0 {
+		t.Fatalf("DecodeQuery empty: got %v, err %v", om, err)
+	}
+}
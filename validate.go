@@ -0,0 +1,265 @@
+package ordered
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// check every key of spec exists with a value of the expected kind, returns an error listing
+// every missing key and every key of a wrong kind together, or nil if all satisfied;
+// the numeric kinds also accept a json.Number, a nested object is of kind reflect.Ptr.
+func (om *OrderedMap) Require(spec map[string]reflect.Kind) error {
+	keys := make([]string, 0, len(spec))
+	for key := range spec {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var problems []string
+	for _, key := range keys {
+		value, ok := om.m[key]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("missing key %q", key))
+			continue
+		}
+		if kind := reflect.ValueOf(value).Kind(); !kindMatches(spec[key], kind, value) {
+			problems = append(problems, fmt.Sprintf("key %q expect kind %v but got %v", key, spec[key], kind))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid OrderedMap: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func kindMatches(expected, kind reflect.Kind, value interface{}) bool {
+	if expected == kind {
+		return true
+	}
+	if _, ok := value.(json.Number); ok {
+		switch expected {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return true
+		}
+	}
+	return false
+}
+
+// check every key of the map is one of the allowed keys, returns an error listing every other key
+// together in the keys order, or nil if all allowed; nested objects are not checked
+func (om *OrderedMap) AllowOnly(keys ...string) error {
+	allowed := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		allowed[key] = true
+	}
+	var unexpected []string
+	for e := om.l.Front(); e != nil; e = e.Next() {
+		if key := e.Value.(string); !allowed[key] {
+			unexpected = append(unexpected, fmt.Sprintf("%q", key))
+		}
+	}
+	if len(unexpected) > 0 {
+		return fmt.Errorf("invalid OrderedMap: unexpected keys %s", strings.Join(unexpected, ", "))
+	}
+	return nil
+}
+
+// check the map against a minimal JSON Schema, supporting the keywords "type" (a name or an array of
+// names, among "object", "array", "string", "number", "integer", "boolean" and "null"), "enum",
+// "required" and "properties", recursing into the nested objects; returns an error listing every
+// violation with its path, such as `$.db.port`, or nil if valid. Other keywords are ignored
+func (om *OrderedMap) ValidateSchema(schema *OrderedMap) error {
+	var problems []string
+	validateSchema("$", om, schema, &problems)
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid OrderedMap: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func validateSchema(path string, v interface{}, schema *OrderedMap, problems *[]string) {
+	if schema == nil {
+		return
+	}
+	report := func(format string, args ...interface{}) {
+		*problems = append(*problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if types, ok := schema.m["type"]; ok {
+		names, ok := schemaStrings(types)
+		if !ok {
+			report("invalid schema: type must be a string or an array of strings")
+			return
+		}
+		if !schemaTypeMatches(names, v) {
+			report("expect type %s but got %q", strings.Join(quoteAll(names), " or "), jsonType(v))
+			return
+		}
+	}
+
+	if enum, ok := schema.m["enum"]; ok {
+		values, ok := enum.([]interface{})
+		if !ok {
+			report("invalid schema: enum must be an array")
+			return
+		}
+		found := false
+		for _, value := range values {
+			if equalValues(v, value) || leafEqual(v, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			b, _ := json.Marshal(v)
+			report("value %s not in enum", b)
+		}
+	}
+
+	obj, ok := v.(*OrderedMap)
+	if !ok || obj == nil {
+		return
+	}
+	if required, ok := schema.m["required"]; ok {
+		keys, ok := schemaStrings(required)
+		if !ok {
+			report("invalid schema: required must be an array of strings")
+			return
+		}
+		for _, key := range keys {
+			if _, ok := obj.m[key]; !ok {
+				report("missing required key %q", key)
+			}
+		}
+	}
+	if properties, ok := schema.m["properties"]; ok {
+		props, ok := properties.(*OrderedMap)
+		if !ok || props == nil {
+			report("invalid schema: properties must be an object")
+			return
+		}
+		for e := props.l.Front(); e != nil; e = e.Next() {
+			key := e.Value.(string)
+			value, ok := obj.m[key]
+			if !ok {
+				continue
+			}
+			sub, ok := props.m[key].(*OrderedMap)
+			if !ok {
+				report("invalid schema: property %q must be an object", key)
+				continue
+			}
+			validateSchema(path+"."+key, value, sub, problems)
+		}
+	}
+}
+
+// the strings of a schema keyword, a single string or an array of strings
+func schemaStrings(v interface{}) ([]string, bool) {
+	if s, ok := v.(string); ok {
+		return []string{s}, true
+	}
+	arr, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	res := make([]string, 0, len(arr))
+	for _, elem := range arr {
+		s, ok := elem.(string)
+		if !ok {
+			return nil, false
+		}
+		res = append(res, s)
+	}
+	return res, true
+}
+
+func schemaTypeMatches(names []string, v interface{}) bool {
+	actual := jsonType(v)
+	for _, name := range names {
+		switch name {
+		case actual:
+			return true
+		case "boolean":
+			if actual == "bool" {
+				return true
+			}
+		case "integer":
+			if f, ok := toFloat(v); ok && f == math.Trunc(f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func quoteAll(names []string) []string {
+	res := make([]string, len(names))
+	for i, name := range names {
+		res[i] = strconv.Quote(name)
+	}
+	return res
+}
+
+// return the keys of the map, in order, not decoded into any field of the struct v (or pointer to a
+// struct), such as for migration tooling: the fields are named by their json tag, or by the field name
+// if untagged, and matched the same as json.Unmarshal, case-insensitively, with the fields of the
+// embedded structs promoted; the unexported fields and the ones tagged "-" match no key. For a v that
+// is no struct, every key is unknown
+func (om *OrderedMap) UnknownKeysFor(v interface{}) []string {
+	names := make(map[string]bool)
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t != nil && t.Kind() == reflect.Struct {
+		jsonFieldNames(t, names, make(map[reflect.Type]bool))
+	}
+	unknown := make([]string, 0)
+	for e := om.l.Front(); e != nil; e = e.Next() {
+		if key := e.Value.(string); !names[strings.ToLower(key)] {
+			unknown = append(unknown, key)
+		}
+	}
+	return unknown
+}
+
+// add the lower case JSON names of the fields of the struct type t to names
+func jsonFieldNames(t reflect.Type, names map[string]bool, visited map[reflect.Type]bool) {
+	if visited[t] {
+		return
+	}
+	visited[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				jsonFieldNames(ft, names, visited)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names[strings.ToLower(name)] = true
+	}
+}
@@ -0,0 +1,168 @@
+package ordered
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRequire(t *testing.T) {
+	om := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"name": "x", "age": 3, "ratio": 0.5, "ok": true, "tags": [], "meta": {}}`), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+
+	err := om.Require(map[string]reflect.Kind{
+		"name":  reflect.String,
+		"age":   reflect.Int,
+		"ratio": reflect.Float64,
+		"ok":    reflect.Bool,
+		"tags":  reflect.Slice,
+		"meta":  reflect.Ptr,
+	})
+	if err != nil {
+		t.Fatalf("Require: %v", err)
+	}
+
+	err = om.Require(map[string]reflect.Kind{"name": reflect.String, "email": reflect.String})
+	if err == nil || !strings.Contains(err.Error(), `missing key "email"`) {
+		t.Fatalf("Require: expect missing key error but got %v", err)
+	}
+
+	err = om.Require(map[string]reflect.Kind{"name": reflect.Int})
+	if err == nil || !strings.Contains(err.Error(), `key "name" expect kind int but got string`) {
+		t.Fatalf("Require: expect wrong kind error but got %v", err)
+	}
+
+	err = om.Require(map[string]reflect.Kind{"email": reflect.String, "ok": reflect.String, "age": reflect.Int, "zip": reflect.Int})
+	if err == nil {
+		t.Fatal("Require: expecting error")
+	}
+	for _, problem := range []string{`missing key "email"`, `key "ok" expect kind string but got bool`, `missing key "zip"`} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Fatalf("Require: expect error %q to contain %q", err, problem)
+		}
+	}
+	if strings.Contains(err.Error(), `"age"`) {
+		t.Fatalf("Require: expect error %q not to report the satisfied key", err)
+	}
+}
+
+func TestAllowOnly(t *testing.T) {
+	om := NewOrderedMapFromKVPairs([]*KVPair{{"name", "x"}, {"age", 3}, {"nested", NewOrderedMapFromKVPairs([]*KVPair{{"other", 1}})}})
+	if err := om.AllowOnly("age", "name", "nested", "email"); err != nil {
+		t.Fatalf("AllowOnly: %v", err)
+	}
+
+	err := om.AllowOnly("name", "nested")
+	if err == nil || err.Error() != `invalid OrderedMap: unexpected keys "age"` {
+		t.Fatalf("AllowOnly: expect one unexpected key, got %v", err)
+	}
+	om.Set("zz", true)
+	err = om.AllowOnly("nested")
+	if err == nil || err.Error() != `invalid OrderedMap: unexpected keys "name", "age", "zz"` {
+		t.Fatalf("AllowOnly: expect all unexpected keys, got %v", err)
+	}
+	if err := NewOrderedMap().AllowOnly(); err != nil {
+		t.Fatalf("AllowOnly empty: %v", err)
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	newMap := func(data string) *OrderedMap {
+		om := NewOrderedMap()
+		if err := json.Unmarshal([]byte(data), om); err != nil {
+			t.Fatalf("Unmarshal OrderedMap: %v", err)
+		}
+		return om
+	}
+	schema := newMap(`{
+		"type": "object",
+		"required": ["name", "db"],
+		"properties": {
+			"name": {"type": "string"},
+			"mode": {"enum": ["dev", "prod", 1]},
+			"debug": {"type": ["boolean", "null"]},
+			"db": {
+				"type": "object",
+				"required": ["host"],
+				"properties": {"port": {"type": "integer"}, "host": {"type": "string"}}
+			}
+		}
+	}`)
+
+	valid := newMap(`{"name": "app", "mode": "prod", "debug": null, "db": {"host": "h", "port": 5432.0}, "extra": 1}`)
+	if err := valid.ValidateSchema(schema); err != nil {
+		t.Fatalf("ValidateSchema valid: %v", err)
+	}
+	if err := newMap(`{"name": "app", "mode": 1.0, "db": {"host": "h"}}`).ValidateSchema(schema); err != nil {
+		t.Fatalf("ValidateSchema numeric enum: %v", err)
+	}
+
+	tests := []struct {
+		data     string
+		expected string
+	}{
+		{`{"name": 1, "db": {"host": "h"}}`, `$.name: expect type "string" but got "number"`},
+		{`{"name": "app", "db": {"host": "h", "port": 1.5}}`, `$.db.port: expect type "integer" but got "number"`},
+		{`{"name": "app", "debug": "yes", "db": {"host": "h"}}`, `$.debug: expect type "boolean" or "null" but got "string"`},
+		{`{"db": {"host": "h"}}`, `$: missing required key "name"`},
+		{`{"name": "app", "db": {}}`, `$.db: missing required key "host"`},
+		{`{"name": "app", "mode": "test", "db": {"host": "h"}}`, `$.mode: value "test" not in enum`},
+		{
+			`{"mode": "test", "db": {"port": "80"}}`,
+			`$: missing required key "name"; $.mode: value "test" not in enum; ` +
+				`$.db: missing required key "host"; $.db.port: expect type "integer" but got "string"`,
+		},
+	}
+	for _, test := range tests {
+		err := newMap(test.data).ValidateSchema(schema)
+		if expected := "invalid OrderedMap: " + test.expected; err == nil || err.Error() != expected {
+			t.Fatalf("ValidateSchema %s:\nhave: %v\nwant: %s", test.data, err, expected)
+		}
+	}
+
+	if err := valid.ValidateSchema(newMap(`{"type": 1}`)); err == nil || !strings.Contains(err.Error(), "invalid schema") {
+		t.Fatalf("ValidateSchema malformed schema: got %v", err)
+	}
+}
+
+func TestUnknownKeysFor(t *testing.T) {
+	type Base struct {
+		ID      int `json:"id"`
+		Created string
+	}
+	type Config struct {
+		Base
+		Name     string `json:"name"`
+		Port     int    `json:"listen_port,omitempty"`
+		Host     string
+		Secret   string `json:"-"`
+		internal string
+	}
+
+	om := NewOrderedMap()
+	data := `{"id": 1, "created": "now", "name": "app", "listen_port": 80, "HOST": "h"}`
+	if err := json.Unmarshal([]byte(data), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	if unknown := om.UnknownKeysFor(Config{}); len(unknown) != 0 {
+		t.Fatalf("UnknownKeysFor all matching: got %v", unknown)
+	}
+
+	om.Set("Port", 81)
+	om.Set("Secret", "s")
+	om.Set("internal", "i")
+	om.Set("extra", true)
+	expected := []string{"Port", "Secret", "internal", "extra"}
+	if unknown := om.UnknownKeysFor(&Config{}); !reflect.DeepEqual(unknown, expected) {
+		t.Fatalf("UnknownKeysFor: got %v, expected %v", unknown, expected)
+	}
+	if unknown := om.UnknownKeysFor(Base{}); !reflect.DeepEqual(unknown[:3], []string{"name", "listen_port", "HOST"}) {
+		t.Fatalf("UnknownKeysFor Base: got %v", unknown)
+	}
+	if unknown := om.UnknownKeysFor(1); len(unknown) != om.Len() {
+		t.Fatalf("UnknownKeysFor not a struct: got %v", unknown)
+	}
+}
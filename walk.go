@@ -0,0 +1,485 @@
+package ordered
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// apply fn to every leaf value of the tree, descending into nested OrderedMap and []interface{}
+// values, storing the results in place so the keys order is untouched
+func (om *OrderedMap) transformLeaves(fn func(v interface{}) interface{}) {
+	om.modify("transform")
+	for e := om.l.Front(); e != nil; e = e.Next() {
+		key := e.Value.(string)
+		om.m[key] = transformValue(om.m[key], fn)
+	}
+}
+
+func transformValue(v interface{}, fn func(v interface{}) interface{}) interface{} {
+	switch v := v.(type) {
+	case *OrderedMap:
+		v.transformLeaves(fn)
+		return v
+	case []interface{}:
+		for i := range v {
+			v[i] = transformValue(v[i], fn)
+		}
+		return v
+	}
+	return fn(v)
+}
+
+// convert every json.Number value of the tree into a native number: int64 when it has no
+// fraction or exponent part and fits in int64, float64 otherwise
+func (om *OrderedMap) NormalizeNumbers() {
+	om.transformLeaves(func(v interface{}) interface{} {
+		num, ok := v.(json.Number)
+		if !ok {
+			return v
+		}
+		if !strings.ContainsAny(string(num), ".eE") {
+			if i, err := num.Int64(); err == nil {
+				return i
+			}
+		}
+		if f, err := num.Float64(); err == nil {
+			return f
+		}
+		return v
+	})
+}
+
+// convert every string value of the tree that is a valid JSON number literal, such as "42" or "-1.5e3",
+// into a json.Number of the same text; other strings, such as " 42" or "0x2a", are left alone
+func (om *OrderedMap) CoerceStringNumbers() {
+	om.transformLeaves(func(v interface{}) interface{} {
+		if s, ok := v.(string); ok && isValidNumber(s) {
+			return json.Number(s)
+		}
+		return v
+	})
+}
+
+// remove the leading and trailing white space of every string value of the tree, as strings.TrimSpace
+func (om *OrderedMap) TrimStrings() {
+	om.transformLeaves(func(v interface{}) interface{} {
+		if s, ok := v.(string); ok {
+			return strings.TrimSpace(s)
+		}
+		return v
+	})
+}
+
+// convert every map[string]interface{} value of the tree, as set by callers, into an OrderedMap
+// with its keys sorted, the same order json.Marshal writes them, so the whole tree takes part in
+// the ordered operations; the maps nested in the converted ones are converted too
+func (om *OrderedMap) DeepConvertMaps() {
+	om.transformLeaves(convertMaps)
+}
+
+func convertMaps(v interface{}) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok || m == nil {
+		return v
+	}
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	res := NewOrderedMap()
+	for _, key := range keys {
+		res.Set(key, transformValue(m[key], convertMaps))
+	}
+	return res
+}
+
+// replace every ${NAME} reference in the string values of the tree by its value from lookup, such as
+// os.LookupEnv, which is used when lookup is nil; the references lookup doesn't know are left as they are,
+// so a missing variable stays visible. Only the ${NAME} form is expanded, not $NAME
+func (om *OrderedMap) ExpandEnv(lookup func(string) (string, bool)) {
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	om.transformLeaves(func(v interface{}) interface{} {
+		if s, ok := v.(string); ok {
+			return expandRefs(s, lookup)
+		}
+		return v
+	})
+}
+
+func expandRefs(s string, lookup func(string) (string, bool)) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(s[start+2:], '}')
+		if end < 0 {
+			break
+		}
+		end += start + 2
+		b.WriteString(s[:start])
+		if value, ok := lookup(s[start+2 : end]); ok {
+			b.WriteString(value)
+		} else {
+			b.WriteString(s[start : end+1])
+		}
+		s = s[end+1:]
+	}
+	if b.Len() == 0 {
+		return s
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+// return a line "path = value" for every leaf, such as `a.b[0].c = 3`, sorted for a stable, grep friendly
+// debug output: the path joins the keys by '.' and follows each array index in brackets, the value is
+// its JSON encoding, and an empty object or array is a leaf of its own
+func (om *OrderedMap) DebugLines() []string {
+	lines := make([]string, 0, om.Len())
+	if om.Len() > 0 {
+		debugLines("", true, om, &lines)
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// root tells the path is of the map itself, so an empty key under the root still takes a '.'
+func debugLines(path string, root bool, v interface{}, lines *[]string) {
+	switch v := v.(type) {
+	case *OrderedMap:
+		if v != nil && v.l.Len() > 0 {
+			for e := v.l.Front(); e != nil; e = e.Next() {
+				key := e.Value.(string)
+				if root {
+					debugLines(key, false, v.m[key], lines)
+				} else {
+					debugLines(path+"."+key, false, v.m[key], lines)
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if len(v) > 0 {
+			for i, elem := range v {
+				debugLines(path+"["+strconv.Itoa(i)+"]", false, elem, lines)
+			}
+			return
+		}
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		b = []byte(fmt.Sprint(v))
+	}
+	*lines = append(*lines, path+" = "+string(b))
+}
+
+// count every key of the map and nested OrderedMap values, plus every element of nested arrays
+func (om *OrderedMap) NodeCount() int {
+	n := 0
+	for e := om.l.Front(); e != nil; e = e.Next() {
+		n += 1 + countNodes(om.m[e.Value.(string)])
+	}
+	return n
+}
+
+func countNodes(v interface{}) int {
+	switch v := v.(type) {
+	case *OrderedMap:
+		if v != nil {
+			return v.NodeCount()
+		}
+	case []interface{}:
+		n := len(v)
+		for _, elem := range v {
+			n += countNodes(elem)
+		}
+		return n
+	}
+	return 0
+}
+
+// count the values of every JSON type ("string", "number", "bool", "null", "object" and "array", as
+// ValueType) in the map and all nested OrderedMap and []interface{} values, the map itself not counted
+func (om *OrderedMap) TypeHistogram() map[string]int {
+	res := make(map[string]int)
+	om.countTypes(res)
+	return res
+}
+
+func (om *OrderedMap) countTypes(res map[string]int) {
+	for e := om.l.Front(); e != nil; e = e.Next() {
+		countValueTypes(om.m[e.Value.(string)], res)
+	}
+}
+
+func countValueTypes(v interface{}, res map[string]int) {
+	res[jsonType(v)]++
+	switch v := v.(type) {
+	case *OrderedMap:
+		if v != nil {
+			v.countTypes(res)
+		}
+	case []interface{}:
+		for _, elem := range v {
+			countValueTypes(elem, res)
+		}
+	}
+}
+
+// rename every key of the map and nested OrderedMap values, also inside arrays, to the result of fn,
+// keeping the keys order, such as for converting snake_case to camelCase; if two keys of the same
+// object end with the same name, an error is returned and no key is renamed
+func (om *OrderedMap) MapKeys(fn func(key string) string) error {
+	renamed := make(map[*OrderedMap][]string)
+	if err := om.planKeys(fn, renamed); err != nil {
+		return err
+	}
+	for m, keys := range renamed {
+		m.renameKeys(keys)
+	}
+	return nil
+}
+
+// collect the new keys of the map and its nested maps, in the keys order
+func (om *OrderedMap) planKeys(fn func(key string) string, renamed map[*OrderedMap][]string) error {
+	om.modify("MapKeys")
+	if _, ok := renamed[om]; ok {
+		return nil
+	}
+	keys := make([]string, 0, om.l.Len())
+	from := make(map[string]string, om.l.Len())
+	for e := om.l.Front(); e != nil; e = e.Next() {
+		key := e.Value.(string)
+		newKey := fn(key)
+		if prev, ok := from[newKey]; ok {
+			return fmt.Errorf("keys %q and %q both map to %q", prev, key, newKey)
+		}
+		from[newKey] = key
+		keys = append(keys, newKey)
+	}
+	renamed[om] = keys
+	for e := om.l.Front(); e != nil; e = e.Next() {
+		if err := planValueKeys(om.m[e.Value.(string)], fn, renamed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func planValueKeys(v interface{}, fn func(key string) string, renamed map[*OrderedMap][]string) error {
+	switch v := v.(type) {
+	case *OrderedMap:
+		if v != nil {
+			return v.planKeys(fn, renamed)
+		}
+	case []interface{}:
+		for _, elem := range v {
+			if err := planValueKeys(elem, fn, renamed); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// replace the keys by the new ones, given in the keys order
+func (om *OrderedMap) renameKeys(keys []string) {
+	m := make(map[string]interface{}, len(keys))
+	elems := make(map[string]*list.Element, len(keys))
+	var meta map[string]*keyMeta
+	i := 0
+	for e := om.l.Front(); e != nil; e = e.Next() {
+		key, newKey := e.Value.(string), keys[i]
+		i++
+		m[newKey] = om.m[key]
+		elems[newKey] = e
+		if km, ok := om.meta[key]; ok {
+			if meta == nil {
+				meta = make(map[string]*keyMeta)
+			}
+			// the quoting of the old key no longer applies
+			km.rawKey = nil
+			meta[newKey] = km
+		}
+		e.Value = newKey
+	}
+	om.m, om.keys, om.meta = m, elems, meta
+}
+
+// report whether the map contains itself, directly or through the nested OrderedMap, []interface{},
+// MultiValue, []*OrderedMap and map[string]interface{} values, which would make marshalling recurse
+// forever; a map or an array shared at several places is not a cycle
+func (om *OrderedMap) HasCycle() bool {
+	return om.hasCycle(make(map[interface{}]bool))
+}
+
+// an array or a map[string]interface{} on the path of hasCycle, by its data, same as encoding/json
+type cycleKey struct {
+	ptr uintptr
+	len int
+}
+
+// walk the tree, path holding the maps and arrays from the root to om
+func (om *OrderedMap) hasCycle(path map[interface{}]bool) bool {
+	if path[om] {
+		return true
+	}
+	path[om] = true
+	defer delete(path, om)
+	for e := om.l.Front(); e != nil; e = e.Next() {
+		if valueHasCycle(om.m[e.Value.(string)], path) {
+			return true
+		}
+	}
+	return false
+}
+
+func valueHasCycle(v interface{}, path map[interface{}]bool) bool {
+	switch v := v.(type) {
+	case *OrderedMap:
+		return v != nil && v.hasCycle(path)
+	case []interface{}:
+		return arrayHasCycle(v, path)
+	case MultiValue:
+		return arrayHasCycle(v, path)
+	case []*OrderedMap:
+		for _, elem := range v {
+			if elem != nil && elem.hasCycle(path) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		if v == nil {
+			return false
+		}
+		key := cycleKey{reflect.ValueOf(v).Pointer(), -1}
+		if path[key] {
+			return true
+		}
+		path[key] = true
+		defer delete(path, key)
+		for _, value := range v {
+			if valueHasCycle(value, path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func arrayHasCycle(arr []interface{}, path map[interface{}]bool) bool {
+	if len(arr) == 0 {
+		return false
+	}
+	key := cycleKey{reflect.ValueOf(arr).Pointer(), len(arr)}
+	if path[key] {
+		return true
+	}
+	path[key] = true
+	defer delete(path, key)
+	for _, elem := range arr {
+		if valueHasCycle(elem, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// return the path of keys, array indexes as decimal strings, of every leaf value equal to target in the
+// tree, in the keys order; numbers are equal by value whatever their type, such as json.Number("1.0")
+// and 1, other values by reflect.DeepEqual
+func (om *OrderedMap) FindPaths(target interface{}) [][]string {
+	var res [][]string
+	om.findPaths(target, nil, &res)
+	return res
+}
+
+func (om *OrderedMap) findPaths(target interface{}, path []string, res *[][]string) {
+	for e := om.l.Front(); e != nil; e = e.Next() {
+		key := e.Value.(string)
+		findValuePaths(om.m[key], target, append(path, key), res)
+	}
+}
+
+func findValuePaths(v, target interface{}, path []string, res *[][]string) {
+	switch v := v.(type) {
+	case *OrderedMap:
+		if v != nil {
+			v.findPaths(target, path, res)
+			return
+		}
+	case []interface{}:
+		for i, elem := range v {
+			findValuePaths(elem, target, append(path, strconv.Itoa(i)), res)
+		}
+		return
+	}
+	if leafEqual(v, target) {
+		*res = append(*res, append([]string(nil), path...))
+	}
+}
+
+// numbers are compared by value: two integers exactly, any other pair as float64
+func leafEqual(a, b interface{}) bool {
+	if x, ok := toInt(a); ok {
+		if y, ok := toInt(b); ok {
+			return x.Cmp(y) == 0
+		}
+	}
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// the value of an integer type, or of a json.Number without a fraction or an exponent
+func toInt(v interface{}) (*big.Int, bool) {
+	if num, ok := v.(json.Number); ok {
+		if strings.ContainsAny(string(num), ".eE") {
+			return nil, false
+		}
+		return new(big.Int).SetString(string(num), 10)
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return big.NewInt(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return new(big.Int).SetUint64(rv.Uint()), true
+	}
+	return nil, false
+}
+
+// the value of any number type
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), true
+	}
+	return 0, false
+}
@@ -0,0 +1,348 @@
+package ordered
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeNumbers(t *testing.T) {
+	data := []byte(`{"int": 3, "neg": -12, "dec": 1.5, "exp": 1e3, "big": 12345678901234567890, "s": "7",
+		"nested": {"z": 2, "a": [1, 2.25, {"deep": 0}]}}`)
+	om := NewOrderedMap()
+	if err := json.Unmarshal(data, om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	om.NormalizeNumbers()
+
+	expected := NewOrderedMapFromKVPairs([]*KVPair{
+		{"int", int64(3)},
+		{"neg", int64(-12)},
+		{"dec", 1.5},
+		{"exp", float64(1000)},
+		{"big", float64(12345678901234567890)},
+		{"s", "7"},
+		{"nested", NewOrderedMapFromKVPairs([]*KVPair{
+			{"z", int64(2)},
+			{"a", []interface{}{int64(1), 2.25, NewOrderedMapFromKVPairs([]*KVPair{{"deep", int64(0)}})}},
+		})},
+	})
+	if !reflect.DeepEqual(om, expected) {
+		t.Fatalf("NormalizeNumbers: %#v not deeply equal to expected %#v", om, expected)
+	}
+}
+
+func TestCoerceStringNumbers(t *testing.T) {
+	data := []byte(`{"n": "42", "f": "-1.5e3", "s": "abc", "pad": " 42", "hex": "0x2a", "num": 7,
+		"nested": {"a": ["3.25", "x", {"deep": "0"}]}}`)
+	om := NewOrderedMap()
+	if err := json.Unmarshal(data, om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	om.CoerceStringNumbers()
+
+	expected := NewOrderedMapFromKVPairs([]*KVPair{
+		{"n", json.Number("42")},
+		{"f", json.Number("-1.5e3")},
+		{"s", "abc"},
+		{"pad", " 42"},
+		{"hex", "0x2a"},
+		{"num", json.Number("7")},
+		{"nested", NewOrderedMapFromKVPairs([]*KVPair{
+			{"a", []interface{}{json.Number("3.25"), "x", NewOrderedMapFromKVPairs([]*KVPair{{"deep", json.Number("0")}})}},
+		})},
+	})
+	if !reflect.DeepEqual(om, expected) {
+		t.Fatalf("CoerceStringNumbers: %#v not deeply equal to expected %#v", om, expected)
+	}
+}
+
+func TestTrimStrings(t *testing.T) {
+	data := []byte(`{"name": "  x \t\n", "n": 1, "ok": true, "empty": "   ", " key ": [" a", {"b": "b "}, 2.5]}`)
+	om := NewOrderedMap()
+	if err := json.Unmarshal(data, om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	om.TrimStrings()
+
+	expected := NewOrderedMapFromKVPairs([]*KVPair{
+		{"name", "x"},
+		{"n", json.Number("1")},
+		{"ok", true},
+		{"empty", ""},
+		{" key ", []interface{}{"a", NewOrderedMapFromKVPairs([]*KVPair{{"b", "b"}}), json.Number("2.5")}},
+	})
+	if !reflect.DeepEqual(om, expected) {
+		t.Fatalf("TrimStrings: %#v not deeply equal to expected %#v", om, expected)
+	}
+}
+
+func TestNodeCount(t *testing.T) {
+	om := NewOrderedMap()
+	if n := om.NodeCount(); n != 0 {
+		t.Fatalf("NodeCount of empty map: %d", n)
+	}
+	// 4 top-level keys, "b" has 3 elements, the object inside has 2 keys, "d" has 1 element,
+	// "e" has 2 keys, "f" has 2 elements
+	data := []byte(`{"a": 1, "b": [1, 2, {"c": null, "d": [true]}], "e": {"f": [[], {}], "g": "x"}, "h": {}}`)
+	if err := json.Unmarshal(data, om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	if n := om.NodeCount(); n != 14 {
+		t.Fatalf("NodeCount: expect 14 but got %d", n)
+	}
+}
+
+func snakeToCamel(key string) string {
+	parts := strings.Split(key, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+func TestMapKeys(t *testing.T) {
+	om := NewOrderedMap()
+	data := `{"user_name": "x", "home_dir": {"full_path": "/a", "is_link": false}, "item_list": [{"item_id": 1}, 2], "id": 3}`
+	if err := json.Unmarshal([]byte(data), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	om.SetComment("home_dir", "where")
+	if err := om.MapKeys(snakeToCamel); err != nil {
+		t.Fatalf("MapKeys: %v", err)
+	}
+	b, err := json.Marshal(om)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if expected := `{"userName":"x","homeDir":{"fullPath":"/a","isLink":false},"itemList":[{"itemId":1},2],"id":3}`; string(b) != expected {
+		t.Fatalf("MapKeys: got %s, expected %s", b, expected)
+	}
+	if om.Comment("homeDir") != "where" || om.Has("home_dir") {
+		t.Fatalf("MapKeys: comment should follow the key, got %q", om.Comment("homeDir"))
+	}
+	om.Delete("homeDir")
+	om.Set("last", 4)
+	if !reflect.DeepEqual(om.Keys(), []string{"userName", "itemList", "id", "last"}) {
+		t.Fatalf("MapKeys: the map should keep working, got %v", om.Keys())
+	}
+}
+
+func TestMapKeysCollision(t *testing.T) {
+	om := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"a_b": 1, "nested": {"x_y": 2, "xY": 3}}`), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	err := om.MapKeys(snakeToCamel)
+	if err == nil || !strings.Contains(err.Error(), `"x_y" and "xY" both map to "xY"`) {
+		t.Fatalf("MapKeys: expect collision error, got %v", err)
+	}
+	if b, _ := json.Marshal(om); string(b) != `{"a_b":1,"nested":{"x_y":2,"xY":3}}` {
+		t.Fatalf("MapKeys: no key should be renamed on error, got %s", b)
+	}
+}
+
+func TestHasCycle(t *testing.T) {
+	om := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"a": {"b": [1, {"c": null}]}, "d": []}`), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	shared := NewOrderedMapFromKVPairs([]*KVPair{{"x", 1}})
+	om.Set("s1", shared)
+	om.Set("s2", []interface{}{shared, shared})
+	if om.HasCycle() {
+		t.Fatal("HasCycle: a shared map is not a cycle")
+	}
+
+	self := NewOrderedMap()
+	self.Set("self", self)
+	if !self.HasCycle() {
+		t.Fatal("HasCycle: expect a direct cycle")
+	}
+
+	a, _ := om.GetOrderedMap("a")
+	arr := a.Get("b").([]interface{})
+	arr[1].(*OrderedMap).Set("back", []interface{}{om})
+	if !om.HasCycle() || !a.HasCycle() {
+		t.Fatal("HasCycle: expect a cycle through nested maps and arrays")
+	}
+
+	for name, wrap := range map[string]func(om *OrderedMap) interface{}{
+		"MultiValue":             func(om *OrderedMap) interface{} { return MultiValue{1, om} },
+		"[]*OrderedMap":          func(om *OrderedMap) interface{} { return []*OrderedMap{om} },
+		"map[string]interface{}": func(om *OrderedMap) interface{} { return map[string]interface{}{"m": om} },
+	} {
+		om := NewOrderedMap()
+		om.Set("g", wrap(om))
+		if !om.HasCycle() {
+			t.Fatalf("HasCycle: expect a cycle through a %s", name)
+		}
+		if om := NewOrderedMapFromKVPairs([]*KVPair{{"g", wrap(shared)}, {"h", wrap(shared)}}); om.HasCycle() {
+			t.Fatalf("HasCycle: a map shared in a %s is not a cycle", name)
+		}
+	}
+	loop := []interface{}{nil}
+	loop[0] = loop
+	if !NewOrderedMapFromKVPairs([]*KVPair{{"l", loop}}).HasCycle() {
+		t.Fatal("HasCycle: expect a cycle of an array containing itself")
+	}
+	m := map[string]interface{}{}
+	m["m"] = m
+	if !NewOrderedMapFromKVPairs([]*KVPair{{"m", m}}).HasCycle() {
+		t.Fatal("HasCycle: expect a cycle of a map[string]interface{} containing itself")
+	}
+}
+
+func TestTypeHistogram(t *testing.T) {
+	om := NewOrderedMap()
+	data := `{"s": "x", "n": 1, "b": true, "z": null, "o": {"f": 1.5, "e": {}, "a": ["y", false, [2, null]]}, "empty": []}`
+	if err := json.Unmarshal([]byte(data), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	expected := map[string]int{"string": 2, "number": 3, "bool": 2, "null": 2, "object": 2, "array": 3}
+	if h := om.TypeHistogram(); !reflect.DeepEqual(h, expected) {
+		t.Fatalf("TypeHistogram: got %v, expected %v", h, expected)
+	}
+	if h := NewOrderedMap().TypeHistogram(); len(h) != 0 {
+		t.Fatalf("TypeHistogram empty: %v", h)
+	}
+}
+
+func TestFindPaths(t *testing.T) {
+	om := NewOrderedMap()
+	data := `{"a": 1, "b": {"c": 1.0, "d": [2, 1, {"e": 1e0}], "f": "1"}, "g": [[1]], "h": true}`
+	if err := json.Unmarshal([]byte(data), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	expected := [][]string{{"a"}, {"b", "c"}, {"b", "d", "1"}, {"b", "d", "2", "e"}, {"g", "0", "0"}}
+	for _, target := range []interface{}{1, int64(1), 1.0, json.Number("1")} {
+		if paths := om.FindPaths(target); !reflect.DeepEqual(paths, expected) {
+			t.Fatalf("FindPaths %#v: got %v, expected %v", target, paths, expected)
+		}
+	}
+	if paths := om.FindPaths("1"); !reflect.DeepEqual(paths, [][]string{{"b", "f"}}) {
+		t.Fatalf("FindPaths string: got %v", paths)
+	}
+	if paths := om.FindPaths(true); !reflect.DeepEqual(paths, [][]string{{"h"}}) {
+		t.Fatalf("FindPaths bool: got %v", paths)
+	}
+	if paths := om.FindPaths(42); paths != nil {
+		t.Fatalf("FindPaths nowhere: got %v", paths)
+	}
+
+	// integers beyond the float64 precision are compared exactly
+	ids := NewOrderedMap()
+	if err := json.Unmarshal([]byte(`{"x": 9007199254740993, "y": 9007199254740992, "z": 18446744073709551615}`), ids); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	for _, target := range []interface{}{json.Number("9007199254740993"), int64(9007199254740993)} {
+		if paths := ids.FindPaths(target); !reflect.DeepEqual(paths, [][]string{{"x"}}) {
+			t.Fatalf("FindPaths large integer %#v: got %v", target, paths)
+		}
+	}
+	if paths := ids.FindPaths(uint64(18446744073709551615)); !reflect.DeepEqual(paths, [][]string{{"z"}}) {
+		t.Fatalf("FindPaths max uint64: got %v", paths)
+	}
+	if ids.ValueEquals("y", json.Number("9007199254740993")) || !ids.ValueEquals("y", 9007199254740992) {
+		t.Fatal("ValueEquals: expect large integers compared exactly")
+	}
+	if NewOrderedMapFromKVPairs([]*KVPair{{"x", 9007199254740992}}).IsSubsetOf(ids) {
+		t.Fatal("IsSubsetOf: expect large integers compared exactly")
+	}
+}
+
+func TestDeepConvertMaps(t *testing.T) {
+	om := NewOrderedMap()
+	om.Set("z", 1)
+	om.Set("plain", map[string]interface{}{
+		"b": 1,
+		"a": map[string]interface{}{"y": true, "x": nil},
+		"c": []interface{}{map[string]interface{}{"k2": 2, "k1": 1}, "s"},
+	})
+	om.Set("nested", NewOrderedMapFromKVPairs([]*KVPair{{"m", map[string]interface{}{"q": 1, "p": 2}}}))
+	om.Set("nilmap", map[string]interface{}(nil))
+	om.DeepConvertMaps()
+
+	plain, ok := om.GetOrderedMap("plain")
+	if !ok || !reflect.DeepEqual(plain.Keys(), []string{"a", "b", "c"}) {
+		t.Fatalf("DeepConvertMaps: expect an OrderedMap with sorted keys, got %#v", om.Get("plain"))
+	}
+	if a, ok := plain.GetOrderedMap("a"); !ok || !reflect.DeepEqual(a.Keys(), []string{"x", "y"}) {
+		t.Fatalf("DeepConvertMaps: expect a nested OrderedMap, got %#v", plain.Get("a"))
+	}
+	if elems := plain.Get("c").([]interface{}); !reflect.DeepEqual(elems[0].(*OrderedMap).Keys(), []string{"k1", "k2"}) {
+		t.Fatalf("DeepConvertMaps: expect an OrderedMap in array, got %#v", elems[0])
+	}
+	if m, ok := om.GetOrderedMap("nested"); !ok || m.Get("m").(*OrderedMap).Len() != 2 {
+		t.Fatalf("DeepConvertMaps: expect the map in a nested OrderedMap converted, got %#v", om.Get("nested"))
+	}
+
+	b, err := json.Marshal(om)
+	if expected := `{"z":1,"plain":{"a":{"x":null,"y":true},"b":1,"c":[{"k1":1,"k2":2},"s"]},"nested":{"m":{"p":2,"q":1}},"nilmap":null}`; err != nil || string(b) != expected {
+		t.Fatalf("DeepConvertMaps: got %s %v, expected %s", b, err, expected)
+	}
+	om.Get("plain").(*OrderedMap).Prepend("c", "first")
+	if b, _ = json.Marshal(om.Get("plain")); string(b) != `{"c":"first","a":{"x":null,"y":true},"b":1}` {
+		t.Fatalf("DeepConvertMaps: expect the converted map ordered, got %s", b)
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	om := NewOrderedMap()
+	data := `{"home": "${HOME}/app", "unknown": "${NOPE}", "multi": "${USER}@${HOST}:${PORT}", "nested": {"a": ["x-${USER}", 1]},` +
+		` "plain": "$USER", "open": "${USER", "empty": "${}"}`
+	if err := json.Unmarshal([]byte(data), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	env := map[string]string{"HOME": "/home/u", "USER": "u", "HOST": "h", "PORT": "22"}
+	om.ExpandEnv(func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	})
+	b, _ := json.Marshal(om)
+	expected := `{"home":"/home/u/app","unknown":"${NOPE}","multi":"u@h:22","nested":{"a":["x-u",1]},` +
+		`"plain":"$USER","open":"${USER","empty":"${}"}`
+	if string(b) != expected {
+		t.Fatalf("ExpandEnv: got %s, expected %s", b, expected)
+	}
+
+	os.Setenv("ORDERED_TEST_VAR", "v")
+	defer os.Unsetenv("ORDERED_TEST_VAR")
+	om = NewOrderedMapFromKVPairs([]*KVPair{{"a", "${ORDERED_TEST_VAR}"}})
+	om.ExpandEnv(nil)
+	if om.Get("a") != "v" {
+		t.Fatalf("ExpandEnv with os.LookupEnv: got %v", om.Get("a"))
+	}
+}
+
+func TestDebugLines(t *testing.T) {
+	om := NewOrderedMap()
+	data := `{"b": {"c": 3, "a": "x"}, "a": [1, {"k": null}, [true]], "empty": {}, "none": [], "z": 1.5}`
+	if err := json.Unmarshal([]byte(data), om); err != nil {
+		t.Fatalf("Unmarshal OrderedMap: %v", err)
+	}
+	expected := []string{
+		`a[0] = 1`,
+		`a[1].k = null`,
+		`a[2][0] = true`,
+		`b.a = "x"`,
+		`b.c = 3`,
+		`empty = {}`,
+		`none = []`,
+		`z = 1.5`,
+	}
+	if lines := om.DebugLines(); !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("DebugLines: got\n%s\nexpected\n%s", strings.Join(lines, "\n"), strings.Join(expected, "\n"))
+	}
+	if lines := NewOrderedMap().DebugLines(); len(lines) != 0 {
+		t.Fatalf("DebugLines empty map: got %v", lines)
+	}
+	empty := NewOrderedMapFromKVPairs([]*KVPair{{"", NewOrderedMapFromKVPairs([]*KVPair{{"a", 1}, {"", 2}})}})
+	if lines := empty.DebugLines(); !reflect.DeepEqual(lines, []string{`. = 2`, `.a = 1`}) {
+		t.Fatalf("DebugLines empty keys: got %q", lines)
+	}
+}